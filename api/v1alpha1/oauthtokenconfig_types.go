@@ -21,7 +21,37 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// AdditionalField maps a field of the token response to a key of the target secret
+type AdditionalField struct {
+	// Top-level key, dotted path or JSONPath expression of the field in the token response
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+
+	// Name of the field in the target secret where the value will be stored
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+
+	// Optional: fail the token request if the field is missing, else the key is removed from the target secret
+	Required bool `json:"required,omitempty"`
+}
+
+// ConfigMapTargetConfig selects a ConfigMap for the non-sensitive metadata of the token
+type ConfigMapTargetConfig struct {
+	// Name of the ConfigMap, it is written to the namespace of the target secret
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
 // TargetConfig groups fields related to the target secret
+// +kubebuilder:validation:XValidation:rule="!has(self.additionalFields) || self.additionalFields.all(f, f.key != self.accessTokenFieldName && f.key != self.refreshTokenFieldName)",message="additionalFields must not use the keys of the access or refresh token"
+// +kubebuilder:validation:XValidation:rule="!has(self.templates) || !(self.refreshTokenFieldName in self.templates)",message="templates must not replace the refresh token"
 type TargetConfig struct {
 	// Reference to the secret where the token will be written
 	// +kubebuilder:validation:Required
@@ -40,6 +70,44 @@ type TargetConfig struct {
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:default="refresh_token"
 	RefreshTokenFieldName string `json:"refreshTokenFieldName,omitempty"`
+
+	// Optional: additional fields of the token response which are stored in the target secret, e.g. id_token
+	// +listType=map
+	// +listMapKey=key
+	// +kubebuilder:validation:MaxItems=32
+	AdditionalFields []AdditionalField `json:"additionalFields,omitempty"`
+
+	// Optional: keys of the target secret rendered from Go templates with the sprig functions,
+	// e.g. "Bearer {{ .AccessToken }}" for an Authorization header
+	// +kubebuilder:validation:MaxProperties=32
+	// +kubebuilder:validation:XValidation:rule="self.all(k, k.matches('^[a-zA-Z0-9_.-]+$'))",message="template keys must be valid secret keys"
+	Templates map[string]string `json:"templates,omitempty"`
+
+	// Optional: keys of the credentials secret the templates can read as .Credentials, e.g. username, none by default
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=32
+	// +kubebuilder:validation:items:Pattern=^[a-zA-Z0-9_.-]+$
+	TemplateCredentialKeys []string `json:"templateCredentialKeys,omitempty"`
+
+	// Optional: do not store the bare access token, e.g. if a template renders it,
+	// the refresh token is always stored since it is needed for the next refresh
+	OmitAccessToken bool `json:"omitAccessToken,omitempty"`
+
+	// Optional: type of the target secret, e.g. kubernetes.io/dockerconfigjson, only applied when the secret is created
+	Type corev1.SecretType `json:"type,omitempty"`
+
+	// Optional: write the secret to every namespace matching the selector instead of the namespace of secretRef,
+	// only supported for additionalTargets
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Optional: opt in to a ConfigMap holding the expiration times and the granted scope, never the tokens
+	ConfigMap *ConfigMapTargetConfig `json:"configMap,omitempty"`
+
+	// Optional: labels of the secret and the ConfigMap, app.kubernetes.io/managed-by is always set
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Optional: annotations of the secret and the ConfigMap, the annotation pointing to the OAuthTokenConfig is always set
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // CredentialsConfig groups fields related to the credentials secret
@@ -75,38 +143,241 @@ type CredentialsConfig struct {
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:default="password"
 	PasswordFieldName string `json:"passwordFieldName,omitempty"`
+
+	// Optional: the name of the field in the credentials secret where the PEM encoded private key is stored
+	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:default="private_key"
+	PrivateKeyFieldName string `json:"privateKeyFieldName,omitempty"`
+
+	// Optional: the name of the field in the credentials secret where the ID of the private key is stored
+	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:default="key_id"
+	KeyIDFieldName string `json:"keyIdFieldName,omitempty"`
+
+	// Optional: the name of the field in the credentials secret where the initial refresh token is stored
+	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:default="refresh_token"
+	RefreshTokenFieldName string `json:"refreshTokenFieldName,omitempty"`
+}
+
+// JWTBearerConfig groups fields related to the JWT bearer assertion grant (RFC 7523)
+type JWTBearerConfig struct {
+	// Optional: the issuer (iss) of the assertion, defaults to the client ID from the credentials secret
+	Issuer string `json:"issuer,omitempty"`
+
+	// Optional: the subject (sub) of the assertion, defaults to the issuer
+	Subject string `json:"subject,omitempty"`
+
+	// Optional: the audience (aud) of the assertion, defaults to the token URL
+	Audience string `json:"audience,omitempty"`
+
+	// Optional: additional claims of the assertion, e.g. scope
+	Claims map[string]string `json:"claims,omitempty"`
+
+	// Optional: lifetime of the assertion
+	// +kubebuilder:default="5m"
+	Lifetime *metav1.Duration `json:"lifetime,omitempty"`
+
+	// Optional: the algorithm used to sign the assertion
+	// +kubebuilder:validation:Enum=RS256;ES256;PS256
+	// +kubebuilder:default=RS256
+	SigningAlgorithm string `json:"signingAlgorithm,omitempty"`
+}
+
+// ClientAuthenticationConfig groups fields related to the authentication of the client at the token endpoint
+type ClientAuthenticationConfig struct {
+	// Optional: the client authentication method (OpenID Connect Core section 9, RFC 8705 section 2)
+	// tls_client_auth and self_signed_tls_client_auth require the tls section, service_account_token requires the serviceAccountToken section
+	// +kubebuilder:validation:Enum=client_secret_post;client_secret_basic;client_secret_jwt;private_key_jwt;tls_client_auth;self_signed_tls_client_auth;service_account_token;none
+	// +kubebuilder:default=client_secret_post
+	Method string `json:"method,omitempty"`
+
+	// Optional: the client ID, takes precedence over the client ID in the credentials secret
+	ClientID string `json:"clientId,omitempty"`
+
+	// Optional: the algorithm used to sign the client assertion for private_key_jwt, client_secret_jwt always uses HS256
+	// +kubebuilder:validation:Enum=RS256;ES256;PS256
+	// +kubebuilder:default=RS256
+	SigningAlgorithm string `json:"signingAlgorithm,omitempty"`
+
+	// Optional: the audience (aud) of the client assertion, defaults to the token URL
+	Audience string `json:"audience,omitempty"`
+
+	// Optional: lifetime of the client assertion
+	// +kubebuilder:default="1m"
+	Lifetime *metav1.Duration `json:"lifetime,omitempty"`
+}
+
+// TLSConfig groups fields related to the mutual TLS connection to the authorization server (RFC 8705)
+type TLSConfig struct {
+	// Reference to a secret of type kubernetes.io/tls whose certificate and key are presented on the token request,
+	// an optional ca.crt is used to verify the authorization server
+	// +kubebuilder:validation:Required
+	SecretRef corev1.SecretReference `json:"secretRef"`
+}
+
+// ServiceAccountTokenConfig groups fields related to the bound service account token requested through the TokenRequest API
+type ServiceAccountTokenConfig struct {
+	// Name of the service account in the namespace of the OAuthTokenConfig
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	ServiceAccountName string `json:"serviceAccountName"`
+
+	// Audience (aud) of the token, has to be trusted by the authorization server, e.g. api://AzureADTokenExchange
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Audience string `json:"audience"`
+
+	// Optional: requested lifetime of the token in seconds, a new token is requested for every token request
+	// +kubebuilder:validation:Minimum=600
+	// +kubebuilder:default=600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+// SecretKeyReference selects a key of a secret
+type SecretKeyReference struct {
+	// Name of the secret
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Optional: namespace of the secret, defaults to the namespace of the OAuthTokenConfig
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key of the secret holding the value
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// OAuthTokenConfigReference references another OAuthTokenConfig
+type OAuthTokenConfigReference struct {
+	// Name of the OAuthTokenConfig
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Optional: namespace of the OAuthTokenConfig, defaults to the namespace of the referencing OAuthTokenConfig
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// TokenSource selects where a token is read from, exactly one source has to be set
+// +kubebuilder:validation:XValidation:rule="[has(self.oauthTokenConfigRef), has(self.secretKeyRef), has(self.serviceAccountToken) && self.serviceAccountToken].filter(x, x).size() == 1",message="exactly one of oauthTokenConfigRef, secretKeyRef or serviceAccountToken has to be set"
+type TokenSource struct {
+	// Optional: use the access token maintained by another OAuthTokenConfig
+	OAuthTokenConfigRef *OAuthTokenConfigReference `json:"oauthTokenConfigRef,omitempty"`
+
+	// Optional: use the token stored in a key of a secret
+	SecretKeyRef *SecretKeyReference `json:"secretKeyRef,omitempty"`
+
+	// Optional: use a bound token of the service account configured in the serviceAccountToken section, requested
+	// with its audience for every exchange. The token of the controller itself is never used
+	ServiceAccountToken bool `json:"serviceAccountToken,omitempty"`
+}
+
+// TokenExchangeConfig groups fields related to the token exchange grant (RFC 8693)
+type TokenExchangeConfig struct {
+	// Source of the subject token which is exchanged
+	// +kubebuilder:validation:Required
+	SubjectToken TokenSource `json:"subjectToken"`
+
+	// Optional: the type of the subject token
+	// +kubebuilder:default="urn:ietf:params:oauth:token-type:access_token"
+	SubjectTokenType string `json:"subjectTokenType,omitempty"`
+
+	// Optional: the type of the requested token
+	RequestedTokenType string `json:"requestedTokenType,omitempty"`
+
+	// Optional: logical names of the services the token is requested for
+	Audience []string `json:"audience,omitempty"`
+
+	// Optional: URIs of the resources the token is requested for
+	Resource []string `json:"resource,omitempty"`
+
+	// Optional: space separated scopes of the requested token
+	Scope string `json:"scope,omitempty"`
+}
+
+// DeviceCodeConfig groups fields related to the device authorization grant (RFC 8628)
+type DeviceCodeConfig struct {
+	// Optional: URL of the device authorization endpoint, discovered if issuerUrl is set
+	// +kubebuilder:validation:Pattern=`^https?://[a-zA-Z0-9_.-]+(:[0-9]+)?(/.*)?$`
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:MinLength=1
+	DeviceAuthorizationURL string `json:"deviceAuthorizationUrl,omitempty"`
+
+	// Optional: space separated scopes of the requested token, e.g. offline_access to get a refresh token
+	Scope string `json:"scope,omitempty"`
+}
+
+// BackoffConfig groups fields related to the retries of failed reconciliations
+type BackoffConfig struct {
+	// Optional: delay before the first retry, defaults to REQUEUE_TIME of the controller
+	Initial *metav1.Duration `json:"initial,omitempty"`
+
+	// Optional: upper limit of the delay, a longer Retry-After of the authorization server is still honored
+	// Default: BACKOFF_MAX_TIME of the controller
+	Max *metav1.Duration `json:"max,omitempty"`
+
+	// Optional: factor the delay grows by with every failed attempt, a decimal number like 1.5
+	// Default: 2
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	// +kubebuilder:default="2"
+	Multiplier string `json:"multiplier,omitempty"`
+
+	// Optional: random variation of the delay in percent, spreads the retries of resources failing at the same time
+	// Default: 20%
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=20
+	JitterPercentage int32 `json:"jitterPercentage,omitempty"`
 }
 
 // TokenResponseConfig groups fields related to the token response configuration
 type TokenResponseConfig struct {
 
-	// Optional: the name of the field in the token response where the access token is stored
-	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
-	// +kubebuilder:validation:MaxLength=64
+	// Optional: the name of the field in the token response where the access token is stored, a top-level key, dotted path or JSONPath expression
+	// +kubebuilder:validation:MaxLength=256
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:default="access_token"
 	AccessTokenFieldName string `json:"accessTokenFieldName,omitempty"`
 
-	// Optional: the name of the field in the token response where the refresh token is stored
-	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
-	// +kubebuilder:validation:MaxLength=64
+	// Optional: the name of the field in the token response where the refresh token is stored, a top-level key, dotted path or JSONPath expression
+	// +kubebuilder:validation:MaxLength=256
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:default="refresh_token"
 	RefreshTokenFieldName string `json:"refreshTokenFieldName,omitempty"`
 
-	// Optional: the name of the field in the token response where the expiration time is stored
-	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
-	// +kubebuilder:validation:MaxLength=64
+	// Optional: the name of the field in the token response where the expiration time is stored, a top-level key, dotted path or JSONPath expression
+	// +kubebuilder:validation:MaxLength=256
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:default="expires_in"
 	ExpirationFieldName string `json:"expirationFieldName,omitempty"`
 
-	// Optional: the name of the field in the token response where the refresh expiration time is stored
-	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9_.-]+$
-	// +kubebuilder:validation:MaxLength=64
+	// Optional: the name of the field in the token response where the refresh expiration time is stored, a top-level key, dotted path or JSONPath expression
+	// +kubebuilder:validation:MaxLength=256
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:default="refresh_expires_in"
 	RefreshExpirationFieldName string `json:"refreshExpirationFieldName,omitempty"`
+
+	// Optional: the format of the expiration fields, seconds relative to the response, seconds or milliseconds
+	// since the epoch or an RFC3339 timestamp
+	// +kubebuilder:validation:Enum=relative;epoch;epochMillis;rfc3339
+	// +kubebuilder:default=relative
+	ExpirationFormat string `json:"expirationFormat,omitempty"`
+}
+
+// ParameterValue is the value of an additional request parameter, exactly one source has to be set
+// +kubebuilder:validation:XValidation:rule="has(self.value) != has(self.secretKeyRef)",message="exactly one of value or secretKeyRef has to be set"
+type ParameterValue struct {
+	// Optional: the literal value of the parameter
+	Value string `json:"value,omitempty"`
+
+	// Optional: read the value of the parameter from a key of a secret
+	SecretKeyRef *SecretKeyReference `json:"secretKeyRef,omitempty"`
 }
 
 // TokenRequestConfig groups fields related to the token request configuration
@@ -147,39 +418,104 @@ type TokenRequestConfig struct {
 	// Optional: the field name for the refresh token in the token request
 	// +kubebuilder:default="refresh_token"
 	RefreshTokenFieldName string `json:"refreshTokenFieldName,omitempty"`
+
+	// Optional: the field name for the assertion in the token request
+	// +kubebuilder:default="assertion"
+	AssertionFieldName string `json:"assertionFieldName,omitempty"`
+
+	// Optional: space separated scopes of the requested token
+	Scope string `json:"scope,omitempty"`
+
+	// Optional: audiences of the requested token, e.g. the API identifier for Auth0 or Okta
+	Audience []string `json:"audience,omitempty"`
+
+	// Optional: URIs of the resources the token is requested for (RFC 8707)
+	Resource []string `json:"resource,omitempty"`
+
+	// Optional: additional parameters sent with every token and device authorization request, not with revocation
+	// requests, parameters set by the grant type itself take precedence
+	ExtraParameters map[string]ParameterValue `json:"extraParameters,omitempty"`
 }
 
 // OAuthTokenConfigSpec defines the desired state of OAuthTokenConfig
+// +kubebuilder:validation:XValidation:rule="has(self.tokenUrl) || has(self.issuerUrl)",message="either tokenUrl or issuerUrl has to be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.target.namespaceSelector)",message="target.namespaceSelector is only supported for additionalTargets"
+// +kubebuilder:validation:XValidation:rule="!has(self.tokenExchange) || !has(self.tokenExchange.subjectToken.serviceAccountToken) || !self.tokenExchange.subjectToken.serviceAccountToken || has(self.serviceAccountToken)",message="tokenExchange.subjectToken.serviceAccountToken requires the serviceAccountToken section"
 type OAuthTokenConfigSpec struct {
-	// URL to refresh the token
-	// +kubebuilder:validation:Required
+	// Optional: URL to refresh the token, takes precedence over the token endpoint discovered from issuerUrl
+	// +kubebuilder:validation:Pattern=`^https?://[a-zA-Z0-9_.-]+(:[0-9]+)?(/.*)?$`
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:MinLength=1
+	TokenURL string `json:"tokenUrl,omitempty"`
+
+	// Optional: URL of the issuer whose metadata (OpenID Connect Discovery or RFC 8414) provides the endpoints
 	// +kubebuilder:validation:Pattern=`^https?://[a-zA-Z0-9_.-]+(:[0-9]+)?(/.*)?$`
 	// +kubebuilder:validation:MaxLength=2048
 	// +kubebuilder:validation:MinLength=1
-	TokenURL string `json:"tokenUrl"`
+	IssuerURL string `json:"issuerUrl,omitempty"`
 
-	// OAuth Grant type, one of ["ropc"]
+	// Optional: URL of the revocation endpoint (RFC 7009) the tokens are revoked at when the OAuthTokenConfig is deleted,
+	// takes precedence over the revocation endpoint discovered from issuerUrl
+	// +kubebuilder:validation:Pattern=`^https?://[a-zA-Z0-9_.-]+(:[0-9]+)?(/.*)?$`
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:MinLength=1
+	RevocationURL string `json:"revocationUrl,omitempty"`
+
+	// OAuth Grant type, one of ["ropc", "client_credentials", "jwt-bearer", "token-exchange", "device_code", "refresh_token"]
 	// +kubebuilder:validation:Required
-	// +kubebuilder:validation:Enum=ropc
+	// +kubebuilder:validation:Enum=ropc;client_credentials;jwt-bearer;token-exchange;device_code;refresh_token
 	Type string `json:"type"`
 
-	// Configuration for the target secret
+	// Configuration for the target secret, it also holds the refresh token
 	Target TargetConfig `json:"target"`
 
-	// Configuration for the credentials secret
-	Credentials CredentialsConfig `json:"credentials"`
+	// Optional: further secrets the token is written to, e.g. in other namespaces, they never hold the refresh token
+	// +kubebuilder:validation:MaxItems=32
+	AdditionalTargets []TargetConfig `json:"additionalTargets,omitempty"`
+
+	// Optional: what happens to the secrets and ConfigMaps of the targets when the OAuthTokenConfig is deleted,
+	// Delete removes them, Orphan keeps them and RemoveKeysOnly only removes the keys written by the controller
+	// +kubebuilder:validation:Enum=Delete;Orphan;RemoveKeysOnly
+	// +kubebuilder:default=Delete
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// Optional: configuration for the credentials secret, can be omitted if no credentials are required,
+	// e.g. with a service account token as assertion and the client ID set in clientAuthentication
+	Credentials CredentialsConfig `json:"credentials,omitempty"`
 
 	// Configuration for the token response
 	// +kubebuilder:default={accessTokenFieldName: "access_token", refreshTokenFieldName: "refresh_token", expirationFieldName: "expires_in", refreshExpirationFieldName: "refresh_expires_in"}
 	TokenResponse TokenResponseConfig `json:"tokenResponse"`
 
 	// Configuration for the token request
-	// +kubebuilder:default={method: "POST", contentType: "application/x-www-form-urlencoded", grantTypeFieldName: "grant_type", clientIdFieldName: "client_id", clientSecretFieldName: "client_secret", usernameFieldName: "username", passwordFieldName: "password", refreshTokenFieldName: "refresh_token"}
+	// +kubebuilder:default={method: "POST", contentType: "application/x-www-form-urlencoded", grantTypeFieldName: "grant_type", clientIdFieldName: "client_id", clientSecretFieldName: "client_secret", usernameFieldName: "username", passwordFieldName: "password", refreshTokenFieldName: "refresh_token", assertionFieldName: "assertion"}
 	TokenRequest TokenRequestConfig `json:"tokenRequest"`
 
+	// Optional: configuration of the client authentication, defaults to client_secret_post
+	ClientAuthentication *ClientAuthenticationConfig `json:"clientAuthentication,omitempty"`
+
+	// Optional: client certificate for mutual TLS with the authorization server
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// Optional: request a bound service account token which is used as client assertion (service_account_token client
+	// authentication) or, with the jwt-bearer grant type, as assertion instead of signing one with a private key
+	ServiceAccountToken *ServiceAccountTokenConfig `json:"serviceAccountToken,omitempty"`
+
+	// Optional: configuration of the assertion for the jwt-bearer grant type
+	JWTBearer *JWTBearerConfig `json:"jwtBearer,omitempty"`
+
+	// Optional: configuration of the token-exchange grant type
+	TokenExchange *TokenExchangeConfig `json:"tokenExchange,omitempty"`
+
+	// Optional: configuration of the device_code grant type
+	DeviceCode *DeviceCodeConfig `json:"deviceCode,omitempty"`
+
 	// Optional: time interval between refreshes
 	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
 
+	// Optional: exponential backoff of the retries after a failed reconciliation
+	Backoff *BackoffConfig `json:"backoff,omitempty"`
+
 	// Optional: percentage of token expiration time before refresh
 	// Default: 10%
 	// +kubebuilder:validation:Minimum=0
@@ -188,6 +524,42 @@ type OAuthTokenConfigSpec struct {
 	RefreshBufferPercentage int32 `json:"refreshBufferPercentage,omitempty"`
 }
 
+// DeviceAuthorizationStatus describes a device authorization waiting for the user (RFC 8628)
+type DeviceAuthorizationStatus struct {
+	// Code the user has to enter at the verification URI
+	UserCode string `json:"userCode,omitempty"`
+
+	// URI the user has to visit
+	VerificationURI string `json:"verificationUri,omitempty"`
+
+	// URI the user has to visit which already includes the user code
+	VerificationURIComplete string `json:"verificationUriComplete,omitempty"`
+
+	// Time when the device authorization expires
+	ExpirationTime metav1.Time `json:"expirationTime,omitempty"`
+}
+
+// EndpointsStatus holds the endpoints of the authorization server resolved from the spec and the issuer metadata
+type EndpointsStatus struct {
+	Token               string `json:"token,omitempty"`
+	Revocation          string `json:"revocation,omitempty"`
+	Introspection       string `json:"introspection,omitempty"`
+	DeviceAuthorization string `json:"deviceAuthorization,omitempty"`
+	JWKS                string `json:"jwks,omitempty"`
+}
+
+// WrittenTargetStatus describes the primary target secret the current token was written to
+type WrittenTargetStatus struct {
+	// Name and namespace of the secret
+	SecretRef corev1.SecretReference `json:"secretRef,omitempty"`
+
+	// Key of the access token in the secret
+	AccessTokenFieldName string `json:"accessTokenFieldName,omitempty"`
+
+	// Key of the refresh token in the secret
+	RefreshTokenFieldName string `json:"refreshTokenFieldName,omitempty"`
+}
+
 // OAuthTokenConfigStatus defines the observed state of OAuthTokenConfig
 type OAuthTokenConfigStatus struct {
 	LastRefresh           metav1.Time `json:"lastRefresh,omitempty"`
@@ -195,6 +567,50 @@ type OAuthTokenConfigStatus struct {
 	ExpirationTime        metav1.Time `json:"expirationTime,omitempty"`
 	RefreshExpirationTime metav1.Time `json:"refreshExpirationTime,omitempty"`
 	Status                string      `json:"status,omitempty"`
+
+	// Scope granted by the authorization server with the current token, the requested scope if the server omitted it
+	GrantedScope string `json:"grantedScope,omitempty"`
+
+	// SHA-256 hash of the subject token the current token was exchanged for
+	SubjectTokenHash string `json:"subjectTokenHash,omitempty"`
+
+	// SHA-256 hash of the refresh token from the credentials secret which seeded the current token chain
+	SeedRefreshTokenHash string `json:"seedRefreshTokenHash,omitempty"`
+
+	// SHA-256 hash of the data of the credentials secret the current token was acquired with
+	CredentialsHash string `json:"credentialsHash,omitempty"`
+
+	// SHA-256 hash of the spec fields which affect the token request, e.g. tokenUrl or scope, of the current token
+	TokenRequestHash string `json:"tokenRequestHash,omitempty"`
+
+	// Primary target the current token was written to, a renamed target takes the tokens from it after a restart
+	WrittenTarget *WrittenTargetStatus `json:"writtenTarget,omitempty"`
+
+	// Generation of the spec the current token and targets were written for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Endpoints of the authorization server used for the last token request
+	Endpoints *EndpointsStatus `json:"endpoints,omitempty"`
+
+	// Device authorization the user has to complete, only set while it is pending
+	DeviceAuthorization *DeviceAuthorizationStatus `json:"deviceAuthorization,omitempty"`
+
+	// Failed attempts to revoke the tokens while the OAuthTokenConfig is deleted
+	RevocationAttempts int32 `json:"revocationAttempts,omitempty"`
+
+	// Failed reconciliations since the last successful one
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// Time of the next retry after a failed reconciliation, set by the backoff policy, or of the next revocation attempt
+	NextRetry metav1.Time `json:"nextRetry,omitempty"`
+
+	// Conditions of the resource: Ready, CredentialsValid, TokenAcquired, TargetWritten and RefreshTokenValid
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +kubebuilder:object:root=true
@@ -204,6 +620,7 @@ type OAuthTokenConfigStatus struct {
 // +kubebuilder:printcolumn:name="Token Expiration Time",type=string,JSONPath=`.status.expirationTime`,description="The token expiration time"
 // +kubebuilder:printcolumn:name="Refresh Expiration Time",type=string,JSONPath=`.status.refreshExpirationTime`,description="The refresh token expiration time"
 // +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.status`,description="The current status of the resource"
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the token is acquired and written to the targets"
 
 // OAuthTokenConfig is the Schema for the oauthtokenconfigs API
 type OAuthTokenConfig struct {
@@ -25,6 +25,81 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalField) DeepCopyInto(out *AdditionalField) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalField.
+func (in *AdditionalField) DeepCopy() *AdditionalField {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalField)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackoffConfig) DeepCopyInto(out *BackoffConfig) {
+	*out = *in
+	if in.Initial != nil {
+		in, out := &in.Initial, &out.Initial
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackoffConfig.
+func (in *BackoffConfig) DeepCopy() *BackoffConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BackoffConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientAuthenticationConfig) DeepCopyInto(out *ClientAuthenticationConfig) {
+	*out = *in
+	if in.Lifetime != nil {
+		in, out := &in.Lifetime, &out.Lifetime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientAuthenticationConfig.
+func (in *ClientAuthenticationConfig) DeepCopy() *ClientAuthenticationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientAuthenticationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapTargetConfig) DeepCopyInto(out *ConfigMapTargetConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapTargetConfig.
+func (in *ConfigMapTargetConfig) DeepCopy() *ConfigMapTargetConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapTargetConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CredentialsConfig) DeepCopyInto(out *CredentialsConfig) {
 	*out = *in
@@ -41,6 +116,79 @@ func (in *CredentialsConfig) DeepCopy() *CredentialsConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceAuthorizationStatus) DeepCopyInto(out *DeviceAuthorizationStatus) {
+	*out = *in
+	in.ExpirationTime.DeepCopyInto(&out.ExpirationTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceAuthorizationStatus.
+func (in *DeviceAuthorizationStatus) DeepCopy() *DeviceAuthorizationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceAuthorizationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceCodeConfig) DeepCopyInto(out *DeviceCodeConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceCodeConfig.
+func (in *DeviceCodeConfig) DeepCopy() *DeviceCodeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceCodeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointsStatus) DeepCopyInto(out *EndpointsStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointsStatus.
+func (in *EndpointsStatus) DeepCopy() *EndpointsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JWTBearerConfig) DeepCopyInto(out *JWTBearerConfig) {
+	*out = *in
+	if in.Claims != nil {
+		in, out := &in.Claims, &out.Claims
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Lifetime != nil {
+		in, out := &in.Lifetime, &out.Lifetime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JWTBearerConfig.
+func (in *JWTBearerConfig) DeepCopy() *JWTBearerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(JWTBearerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OAuthTokenConfig) DeepCopyInto(out *OAuthTokenConfig) {
 	*out = *in
@@ -100,18 +248,75 @@ func (in *OAuthTokenConfigList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OAuthTokenConfigReference) DeepCopyInto(out *OAuthTokenConfigReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OAuthTokenConfigReference.
+func (in *OAuthTokenConfigReference) DeepCopy() *OAuthTokenConfigReference {
+	if in == nil {
+		return nil
+	}
+	out := new(OAuthTokenConfigReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OAuthTokenConfigSpec) DeepCopyInto(out *OAuthTokenConfigSpec) {
 	*out = *in
-	out.Target = in.Target
+	in.Target.DeepCopyInto(&out.Target)
+	if in.AdditionalTargets != nil {
+		in, out := &in.AdditionalTargets, &out.AdditionalTargets
+		*out = make([]TargetConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	out.Credentials = in.Credentials
 	out.TokenResponse = in.TokenResponse
 	in.TokenRequest.DeepCopyInto(&out.TokenRequest)
+	if in.ClientAuthentication != nil {
+		in, out := &in.ClientAuthentication, &out.ClientAuthentication
+		*out = new(ClientAuthenticationConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		**out = **in
+	}
+	if in.ServiceAccountToken != nil {
+		in, out := &in.ServiceAccountToken, &out.ServiceAccountToken
+		*out = new(ServiceAccountTokenConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JWTBearer != nil {
+		in, out := &in.JWTBearer, &out.JWTBearer
+		*out = new(JWTBearerConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TokenExchange != nil {
+		in, out := &in.TokenExchange, &out.TokenExchange
+		*out = new(TokenExchangeConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeviceCode != nil {
+		in, out := &in.DeviceCode, &out.DeviceCode
+		*out = new(DeviceCodeConfig)
+		**out = **in
+	}
 	if in.RefreshInterval != nil {
 		in, out := &in.RefreshInterval, &out.RefreshInterval
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(BackoffConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OAuthTokenConfigSpec.
@@ -131,6 +336,29 @@ func (in *OAuthTokenConfigStatus) DeepCopyInto(out *OAuthTokenConfigStatus) {
 	in.NextRefresh.DeepCopyInto(&out.NextRefresh)
 	in.ExpirationTime.DeepCopyInto(&out.ExpirationTime)
 	in.RefreshExpirationTime.DeepCopyInto(&out.RefreshExpirationTime)
+	if in.WrittenTarget != nil {
+		in, out := &in.WrittenTarget, &out.WrittenTarget
+		*out = new(WrittenTargetStatus)
+		**out = **in
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = new(EndpointsStatus)
+		**out = **in
+	}
+	if in.DeviceAuthorization != nil {
+		in, out := &in.DeviceAuthorization, &out.DeviceAuthorization
+		*out = new(DeviceAuthorizationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	in.NextRetry.DeepCopyInto(&out.NextRetry)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OAuthTokenConfigStatus.
@@ -143,10 +371,122 @@ func (in *OAuthTokenConfigStatus) DeepCopy() *OAuthTokenConfigStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParameterValue) DeepCopyInto(out *ParameterValue) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(SecretKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterValue.
+func (in *ParameterValue) DeepCopy() *ParameterValue {
+	if in == nil {
+		return nil
+	}
+	out := new(ParameterValue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyReference) DeepCopyInto(out *SecretKeyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyReference.
+func (in *SecretKeyReference) DeepCopy() *SecretKeyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountTokenConfig) DeepCopyInto(out *ServiceAccountTokenConfig) {
+	*out = *in
+	if in.ExpirationSeconds != nil {
+		in, out := &in.ExpirationSeconds, &out.ExpirationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountTokenConfig.
+func (in *ServiceAccountTokenConfig) DeepCopy() *ServiceAccountTokenConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountTokenConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSConfig) DeepCopyInto(out *TLSConfig) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSConfig.
+func (in *TLSConfig) DeepCopy() *TLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetConfig) DeepCopyInto(out *TargetConfig) {
 	*out = *in
 	out.SecretRef = in.SecretRef
+	if in.AdditionalFields != nil {
+		in, out := &in.AdditionalFields, &out.AdditionalFields
+		*out = make([]AdditionalField, len(*in))
+		copy(*out, *in)
+	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TemplateCredentialKeys != nil {
+		in, out := &in.TemplateCredentialKeys, &out.TemplateCredentialKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ConfigMapTargetConfig)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetConfig.
@@ -159,6 +499,32 @@ func (in *TargetConfig) DeepCopy() *TargetConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenExchangeConfig) DeepCopyInto(out *TokenExchangeConfig) {
+	*out = *in
+	in.SubjectToken.DeepCopyInto(&out.SubjectToken)
+	if in.Audience != nil {
+		in, out := &in.Audience, &out.Audience
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resource != nil {
+		in, out := &in.Resource, &out.Resource
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenExchangeConfig.
+func (in *TokenExchangeConfig) DeepCopy() *TokenExchangeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenExchangeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenRequestConfig) DeepCopyInto(out *TokenRequestConfig) {
 	*out = *in
@@ -169,6 +535,23 @@ func (in *TokenRequestConfig) DeepCopyInto(out *TokenRequestConfig) {
 			(*out)[key] = val
 		}
 	}
+	if in.Audience != nil {
+		in, out := &in.Audience, &out.Audience
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resource != nil {
+		in, out := &in.Resource, &out.Resource
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExtraParameters != nil {
+		in, out := &in.ExtraParameters, &out.ExtraParameters
+		*out = make(map[string]ParameterValue, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenRequestConfig.
@@ -195,3 +578,44 @@ func (in *TokenResponseConfig) DeepCopy() *TokenResponseConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenSource) DeepCopyInto(out *TokenSource) {
+	*out = *in
+	if in.OAuthTokenConfigRef != nil {
+		in, out := &in.OAuthTokenConfigRef, &out.OAuthTokenConfigRef
+		*out = new(OAuthTokenConfigReference)
+		**out = **in
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(SecretKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSource.
+func (in *TokenSource) DeepCopy() *TokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WrittenTargetStatus) DeepCopyInto(out *WrittenTargetStatus) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WrittenTargetStatus.
+func (in *WrittenTargetStatus) DeepCopy() *WrittenTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WrittenTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
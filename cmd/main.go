@@ -21,6 +21,7 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -63,6 +64,10 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var tokenEndpointQPS float64
+	var tokenEndpointBurst int
+	var circuitBreakerFailures int
+	var circuitBreakerCooldown time.Duration
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -81,6 +86,15 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.Float64Var(&tokenEndpointQPS, "token-endpoint-qps", 5,
+		"The token requests per second to the same token endpoint host, shared by all OAuthTokenConfigs. "+
+			"Use 0 to disable the rate limit.")
+	flag.IntVar(&tokenEndpointBurst, "token-endpoint-burst", 10,
+		"The token requests to the same token endpoint host allowed in a burst above --token-endpoint-qps.")
+	flag.IntVar(&circuitBreakerFailures, "circuit-breaker-failures", 5,
+		"The consecutive failed token requests to a host after which requests to it are paused. Use 0 to disable.")
+	flag.DurationVar(&circuitBreakerCooldown, "circuit-breaker-cooldown", time.Minute,
+		"The time token requests to a host are paused before a single request probes it again.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -203,8 +217,9 @@ func main() {
 	}
 
 	if err = (&controller.OAuthTokenConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		EndpointLimiter: controller.NewEndpointLimiter(tokenEndpointQPS, tokenEndpointBurst, circuitBreakerFailures, circuitBreakerCooldown),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "OAuthTokenConfig")
 		os.Exit(1)
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// conflictManagerPattern matches the message of a field manager conflict cause, e.g. `conflict with "argocd-controller"`,
+// writers using Update instead of server-side apply are followed by " using <apiVersion>"
+var conflictManagerPattern = regexp.MustCompile(`^conflict with ("(?:[^"\\]|\\.)*")(.*)$`)
+
+// TargetConflictError is returned if another writer applied different values to fields of a target
+type TargetConflictError struct {
+	Kind     string
+	Name     string
+	Managers []string
+	Fields   []string
+}
+
+func (e *TargetConflictError) Error() string {
+	return fmt.Sprintf("%s %s: fields %s are applied with other values by %s", e.Kind, e.Name, strings.Join(e.Fields, ", "), strings.Join(e.Managers, ", "))
+}
+
+// function to get the field manager of an OAuthTokenConfig, every resource owns the fields it writes on its own
+func fieldManager(oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	manager := "otto/" + oauthTokenConfig.Namespace + "/" + oauthTokenConfig.Name
+
+	// Field managers are limited to 128 characters
+	if len(manager) > 128 {
+		hash := sha256.Sum256([]byte(manager))
+		manager = "otto/" + hex.EncodeToString(hash[:])
+	}
+	return manager
+}
+
+// function to write a resource with server-side apply, conflicts with writers using Update, e.g. a previous version
+// of the controller or kubectl edit, are forced while conflicts with other appliers are returned as TargetConflictError
+func (r *OAuthTokenConfigReconciler) applyResource(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, obj client.Object) error {
+	log := log.FromContext(ctx)
+	manager := client.FieldOwner(fieldManager(oauthTokenConfig))
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	log.V(1).Info("Applying resource", "name", obj.GetName(), "namespace", obj.GetNamespace(), "type", kind)
+
+	err := r.Patch(ctx, obj, client.Apply, manager)
+	if err == nil || !apierrors.IsConflict(err) {
+		return err
+	}
+
+	var statusErr apierrors.APIStatus
+	if !errors.As(err, &statusErr) || statusErr.Status().Details == nil {
+		return err
+	}
+	conflict := &TargetConflictError{Kind: kind, Name: obj.GetNamespace() + "/" + obj.GetName()}
+	for _, cause := range statusErr.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		match := conflictManagerPattern.FindStringSubmatch(cause.Message)
+		if match == nil {
+			return err
+		}
+		if strings.Contains(match[2], " using ") {
+			continue
+		}
+		name, unquoteErr := strconv.Unquote(match[1])
+		if unquoteErr != nil {
+			name = match[1]
+		}
+		if !slices.Contains(conflict.Managers, name) {
+			conflict.Managers = append(conflict.Managers, name)
+		}
+		conflict.Fields = append(conflict.Fields, cause.Field)
+	}
+	if len(conflict.Managers) > 0 {
+		log.Info("Conflict with other field managers", "name", conflict.Name, "managers", conflict.Managers, "fields", conflict.Fields)
+		return conflict
+	}
+
+	log.V(1).Info("Taking over fields written with Update", "name", obj.GetName(), "namespace", obj.GetNamespace(), "type", kind)
+	return r.Patch(ctx, obj, client.Apply, manager, client.ForceOwnership)
+}
@@ -0,0 +1,12 @@
+package controller
+
+// Grant types register themselves with the auth_types registry on import,
+// additional grant types only need to be added to this list
+import (
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/clientcredentials"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/devicecode"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/jwtbearer"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/refreshtoken"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/ropc"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/tokenexchange"
+)
@@ -0,0 +1,177 @@
+package authtypes
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+// Supported client authentication methods (OpenID Connect Core section 9)
+const (
+	ClientAuthenticationSecretPost     = "client_secret_post"
+	ClientAuthenticationSecretBasic    = "client_secret_basic"
+	ClientAuthenticationSecretJWT      = "client_secret_jwt"
+	ClientAuthenticationPrivateKeyJWT  = "private_key_jwt"
+	ClientAuthenticationTLS            = "tls_client_auth"
+	ClientAuthenticationSelfSignedTLS  = "self_signed_tls_client_auth"
+	ClientAuthenticationServiceAccount = "service_account_token"
+	ClientAuthenticationNone           = "none"
+)
+
+// Client assertion type defined in RFC 7523 section 2.2
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Defaults used if the clientAuthentication section is omitted
+const (
+	defaultClientAssertionLifetime         = time.Minute
+	defaultClientAssertionSigningAlgorithm = SigningAlgorithmRS256
+)
+
+// Function to get the configured client authentication method
+func ClientAuthenticationMethod(oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	if oauthTokenConfig.Spec.ClientAuthentication == nil || oauthTokenConfig.Spec.ClientAuthentication.Method == "" {
+		return ClientAuthenticationSecretPost
+	}
+	return oauthTokenConfig.Spec.ClientAuthentication.Method
+}
+
+// Function to validate that the client authentication method fits the rest of the configuration
+func ValidateClientAuthentication(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	switch method := ClientAuthenticationMethod(oauthTokenConfig); method {
+	case ClientAuthenticationTLS, ClientAuthenticationSelfSignedTLS:
+		if oauthTokenConfig.Spec.TLS == nil {
+			return fmt.Errorf("client authentication method %s requires a client certificate in the tls section", method)
+		}
+	case ClientAuthenticationServiceAccount:
+		if oauthTokenConfig.Spec.ServiceAccountToken == nil {
+			return fmt.Errorf("client authentication method %s requires the serviceAccountToken section", method)
+		}
+	}
+	return nil
+}
+
+// Function to list the credentials required by the configured client authentication method
+func ClientAuthenticationFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	credentials := oauthTokenConfig.Spec.Credentials
+	fields := []string{}
+	if oauthTokenConfig.Spec.ClientAuthentication == nil || oauthTokenConfig.Spec.ClientAuthentication.ClientID == "" {
+		fields = append(fields, credentials.ClientIDFieldName)
+	}
+
+	switch ClientAuthenticationMethod(oauthTokenConfig) {
+	case ClientAuthenticationPrivateKeyJWT:
+		return append(fields, credentials.PrivateKeyFieldName)
+	case ClientAuthenticationTLS, ClientAuthenticationSelfSignedTLS, ClientAuthenticationServiceAccount, ClientAuthenticationNone:
+		return fields
+	default:
+		return append(fields, credentials.ClientSecretFieldName)
+	}
+}
+
+// Function to get the client ID, the one configured in the clientAuthentication section takes precedence over the credentials secret
+func ClientID(grantRequest GrantRequest) (string, bool) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	if oauthTokenConfig.Spec.ClientAuthentication != nil && oauthTokenConfig.Spec.ClientAuthentication.ClientID != "" {
+		return oauthTokenConfig.Spec.ClientAuthentication.ClientID, true
+	}
+	clientID, ok := grantRequest.CredentialsSecret.Data[oauthTokenConfig.Spec.Credentials.ClientIDFieldName]
+	return string(clientID), ok
+}
+
+// Function to add the client authentication to the token request parameters,
+// returns the value of the Authorization header if the method needs one
+func ApplyClientAuthentication(ctx context.Context, grantRequest GrantRequest, tokenURL string, data url.Values) (string, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	credentials := grantRequest.CredentialsSecret.Data
+	clientID, hasClientID := ClientID(grantRequest)
+	clientSecret, hasClientSecret := credentials[oauthTokenConfig.Spec.Credentials.ClientSecretFieldName]
+
+	switch method := ClientAuthenticationMethod(oauthTokenConfig); method {
+	case ClientAuthenticationSecretPost:
+		// Only send what is present, grants which require client credentials validate them beforehand
+		if hasClientID {
+			data.Set(oauthTokenConfig.Spec.TokenRequest.ClientIDFieldName, clientID)
+		}
+		if hasClientSecret {
+			data.Set(oauthTokenConfig.Spec.TokenRequest.ClientSecretFieldName, string(clientSecret))
+		}
+		return "", nil
+	case ClientAuthenticationSecretBasic:
+		// Client ID and secret are form encoded before being used as basic auth credentials (RFC 6749 section 2.3.1)
+		userInfo := url.QueryEscape(clientID) + ":" + url.QueryEscape(string(clientSecret))
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userInfo)), nil
+	case ClientAuthenticationSecretJWT, ClientAuthenticationPrivateKeyJWT:
+		assertion, err := clientAssertion(grantRequest, method, tokenURL, clientID)
+		if err != nil {
+			return "", err
+		}
+		data.Set(oauthTokenConfig.Spec.TokenRequest.ClientIDFieldName, clientID)
+		data.Set("client_assertion_type", ClientAssertionType)
+		data.Set("client_assertion", assertion)
+		return "", nil
+	case ClientAuthenticationServiceAccount:
+		// The bound service account token is presented as client assertion, e.g. for workload identity federation
+		assertion, err := ServiceAccountToken(ctx, grantRequest)
+		if err != nil {
+			return "", err
+		}
+		if hasClientID {
+			data.Set(oauthTokenConfig.Spec.TokenRequest.ClientIDFieldName, clientID)
+		}
+		data.Set("client_assertion_type", ClientAssertionType)
+		data.Set("client_assertion", assertion)
+		return "", nil
+	case ClientAuthenticationTLS, ClientAuthenticationSelfSignedTLS, ClientAuthenticationNone:
+		// With mutual TLS the client is authenticated by the certificate of the connection (RFC 8705 section 2)
+		data.Set(oauthTokenConfig.Spec.TokenRequest.ClientIDFieldName, clientID)
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported client authentication method: %s", method)
+	}
+}
+
+// Function to build and sign the client assertion of client_secret_jwt and private_key_jwt
+func clientAssertion(grantRequest GrantRequest, method, tokenURL, clientID string) (string, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	credentials := grantRequest.CredentialsSecret.Data
+
+	clientAuthentication := authv1alpha1.ClientAuthenticationConfig{}
+	if oauthTokenConfig.Spec.ClientAuthentication != nil {
+		clientAuthentication = *oauthTokenConfig.Spec.ClientAuthentication
+	}
+	audience := clientAuthentication.Audience
+	if audience == "" {
+		audience = tokenURL
+	}
+	lifetime := defaultClientAssertionLifetime
+	if clientAuthentication.Lifetime != nil {
+		lifetime = clientAuthentication.Lifetime.Duration
+	}
+
+	// Issuer and subject of a client assertion are the client ID (RFC 7523 section 3)
+	claims, err := AssertionClaims(clientID, clientID, audience, lifetime, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var assertion string
+	if method == ClientAuthenticationSecretJWT {
+		assertion, err = SignJWTWithSecret(claims, credentials[oauthTokenConfig.Spec.Credentials.ClientSecretFieldName])
+	} else {
+		signingAlgorithm := clientAuthentication.SigningAlgorithm
+		if signingAlgorithm == "" {
+			signingAlgorithm = defaultClientAssertionSigningAlgorithm
+		}
+		privateKey := credentials[oauthTokenConfig.Spec.Credentials.PrivateKeyFieldName]
+		keyID := string(credentials[oauthTokenConfig.Spec.Credentials.KeyIDFieldName])
+		assertion, err = SignJWT(claims, signingAlgorithm, privateKey, keyID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to build client assertion: %w", err)
+	}
+	return assertion, nil
+}
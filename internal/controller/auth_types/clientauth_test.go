@@ -0,0 +1,180 @@
+package authtypes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+var _ = Describe("Client authentication", func() {
+	var (
+		mockServer       *httptest.Server
+		receivedForm     url.Values
+		receivedHeader   http.Header
+		grantRequest     GrantRequest
+		oauthTokenConfig authv1alpha1.OAuthTokenConfig
+	)
+
+	BeforeEach(func() {
+		mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bodyBytes, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			receivedForm, err = url.ParseQuery(string(bodyBytes))
+			Expect(err).NotTo(HaveOccurred())
+			receivedHeader = r.Header
+
+			_, err = w.Write([]byte(`{"access_token": "mock-access-token", "expires_in": 360}`))
+			Expect(err).NotTo(HaveOccurred())
+		}))
+
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		oauthTokenConfig = authv1alpha1.OAuthTokenConfig{
+			Spec: authv1alpha1.OAuthTokenConfigSpec{
+				TokenURL: mockServer.URL + "/oauth/token",
+				Credentials: authv1alpha1.CredentialsConfig{
+					ClientIDFieldName:     "client_id",
+					ClientSecretFieldName: "client_secret",
+					PrivateKeyFieldName:   "private_key",
+					KeyIDFieldName:        "key_id",
+				},
+				TokenRequest: authv1alpha1.TokenRequestConfig{
+					Method:                "POST",
+					ContentType:           ContentTypeForm,
+					GrantTypeFieldName:    "grant_type",
+					ClientIDFieldName:     "client_id",
+					ClientSecretFieldName: "client_secret",
+				},
+				TokenResponse: authv1alpha1.TokenResponseConfig{
+					AccessTokenFieldName:       "access_token",
+					RefreshTokenFieldName:      "refresh_token",
+					ExpirationFieldName:        "expires_in",
+					RefreshExpirationFieldName: "refresh_expires_in",
+				},
+			},
+		}
+		grantRequest = GrantRequest{
+			HTTPClient: mockServer.Client(),
+			CredentialsSecret: corev1.Secret{
+				Data: map[string][]byte{
+					"client_id":     []byte("test client"),
+					"client_secret": []byte("test/secret"),
+					"private_key":   pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}),
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		mockServer.Close()
+	})
+
+	// Function to request a token with the given client authentication method
+	getToken := func(method string) {
+		if method != "" {
+			oauthTokenConfig.Spec.ClientAuthentication = &authv1alpha1.ClientAuthenticationConfig{Method: method}
+		}
+		grantRequest.OAuthTokenConfig = oauthTokenConfig
+
+		data := url.Values{}
+		data.Set("grant_type", "client_credentials")
+		tokens, err := GetToken(context.Background(), grantRequest, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.AccessToken).To(Equal("mock-access-token"))
+	}
+
+	It("should send the client credentials in the body by default", func() {
+		getToken("")
+		Expect(receivedForm.Get("client_id")).To(Equal("test client"))
+		Expect(receivedForm.Get("client_secret")).To(Equal("test/secret"))
+		Expect(receivedHeader.Get("Authorization")).To(BeEmpty())
+	})
+
+	It("should send the form encoded client credentials as basic auth for client_secret_basic", func() {
+		getToken(ClientAuthenticationSecretBasic)
+		Expect(receivedForm).NotTo(HaveKey("client_secret"))
+
+		request, err := http.NewRequest("GET", "/", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Authorization", receivedHeader.Get("Authorization"))
+		username, password, ok := request.BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(username).To(Equal("test+client"))
+		Expect(password).To(Equal("test%2Fsecret"))
+	})
+
+	It("should send a signed client assertion for private_key_jwt", func() {
+		getToken(ClientAuthenticationPrivateKeyJWT)
+		Expect(receivedForm).NotTo(HaveKey("client_secret"))
+		Expect(receivedForm.Get("client_id")).To(Equal("test client"))
+		Expect(receivedForm.Get("client_assertion_type")).To(Equal(ClientAssertionType))
+		Expect(strings.Split(receivedForm.Get("client_assertion"), ".")).To(HaveLen(3))
+	})
+
+	It("should send a client assertion signed with the client secret for client_secret_jwt", func() {
+		getToken(ClientAuthenticationSecretJWT)
+		Expect(receivedForm).NotTo(HaveKey("client_secret"))
+		Expect(receivedForm.Get("client_assertion_type")).To(Equal(ClientAssertionType))
+		Expect(strings.Split(receivedForm.Get("client_assertion"), ".")).To(HaveLen(3))
+	})
+
+	It("should only send the client ID for none", func() {
+		getToken(ClientAuthenticationNone)
+		Expect(receivedForm.Get("client_id")).To(Equal("test client"))
+		Expect(receivedForm).NotTo(HaveKey("client_secret"))
+		Expect(receivedForm).NotTo(HaveKey("client_assertion"))
+	})
+
+	It("should send a bound service account token as client assertion for service_account_token", func() {
+		oauthTokenConfig.Namespace = "default"
+		oauthTokenConfig.Spec.ServiceAccountToken = &authv1alpha1.ServiceAccountTokenConfig{
+			ServiceAccountName: "workload",
+			Audience:           "api://AzureADTokenExchange",
+		}
+		grantRequest.KubeClient = fake.NewClientBuilder().WithObjects(&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "default"},
+		}).Build()
+		grantRequest.CredentialsSecret = corev1.Secret{}
+		oauthTokenConfig.Spec.ClientAuthentication = &authv1alpha1.ClientAuthenticationConfig{
+			Method:   ClientAuthenticationServiceAccount,
+			ClientID: "workload-client",
+		}
+		Expect(ClientAuthenticationFields(oauthTokenConfig)).To(BeEmpty())
+
+		getToken("")
+		Expect(receivedForm.Get("client_id")).To(Equal("workload-client"))
+		Expect(receivedForm.Get("client_assertion_type")).To(Equal(ClientAssertionType))
+		Expect(receivedForm.Get("client_assertion")).To(Equal("fake-token"))
+		Expect(receivedForm).NotTo(HaveKey("client_secret"))
+	})
+
+	It("should fail for service_account_token if the service account does not exist", func() {
+		oauthTokenConfig.Namespace = "default"
+		oauthTokenConfig.Spec.ServiceAccountToken = &authv1alpha1.ServiceAccountTokenConfig{
+			ServiceAccountName: "missing",
+			Audience:           "api://AzureADTokenExchange",
+		}
+		oauthTokenConfig.Spec.ClientAuthentication = &authv1alpha1.ClientAuthenticationConfig{Method: ClientAuthenticationServiceAccount}
+		grantRequest.KubeClient = fake.NewClientBuilder().Build()
+		grantRequest.OAuthTokenConfig = oauthTokenConfig
+
+		_, err := GetToken(context.Background(), grantRequest, url.Values{})
+		Expect(err).To(MatchError(ContainSubstring("failed to request token for service account default/missing")))
+	})
+})
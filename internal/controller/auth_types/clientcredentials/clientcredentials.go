@@ -0,0 +1,50 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/url"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+)
+
+// GrantType is the name under which the client credentials grant is registered
+const GrantType = "client_credentials"
+
+func init() {
+	authtypes.Register(GrantType, Handler{})
+}
+
+// Handler implements the client credentials grant
+type Handler struct{}
+
+// Function to get the grant_type value of the client credentials grant
+func (Handler) AdvertisedGrantType() string {
+	return "client_credentials"
+}
+
+// Function to list the credentials required by the client credentials grant
+func (Handler) RequiredCredentialFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	return authtypes.ClientAuthenticationFields(oauthTokenConfig)
+}
+
+// Function to validate the client credentials specific configuration
+func (Handler) Validate(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	return nil
+}
+
+// Function to get a new token using the client ID and client secret
+func (Handler) Acquire(ctx context.Context, grantRequest authtypes.GrantRequest) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+
+	data := url.Values{}
+	data.Set(oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName, "client_credentials")
+
+	return authtypes.GetToken(ctx, grantRequest, data)
+}
+
+// Function to refresh the token, the client credentials grant has no refresh token (RFC 6749 section 4.4.3) so a new token is requested
+func (h Handler) Refresh(ctx context.Context, grantRequest authtypes.GrantRequest, refreshToken string) (*definitions.Tokens, error) {
+	return h.Acquire(ctx, grantRequest)
+}
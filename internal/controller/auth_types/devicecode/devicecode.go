@@ -0,0 +1,221 @@
+package devicecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// GrantType is the name under which the device authorization grant is registered
+const GrantType = "device_code"
+
+// Grant type URN defined in RFC 8628 section 3.4
+const grantTypeURN = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Polling intervals defined in RFC 8628 section 3.2 and 3.5
+const (
+	defaultInterval  = 5 * time.Second
+	slowDownInterval = 5 * time.Second
+)
+
+func init() {
+	authtypes.Register(GrantType, Handler{})
+}
+
+// Handler implements the device authorization grant (RFC 8628), the device codes of pending authorizations
+// are kept in the grant state of the reconciler only, after a restart of the controller a new authorization is started
+type Handler struct{}
+
+// deviceAuthorization is a device authorization waiting for the user, it is replaced instead of modified
+type deviceAuthorization struct {
+	deviceAuthorizationURL string
+	deviceCode             string
+	interval               time.Duration
+	expiresAt              time.Time
+	nextPoll               time.Time
+}
+
+// deviceAuthorizationResponse is the response of the device authorization endpoint (RFC 8628 section 3.2)
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Function to get the grant_type value of the device authorization grant
+func (Handler) AdvertisedGrantType() string {
+	return grantTypeURN
+}
+
+// Function to list the credentials required by the device authorization grant
+func (Handler) RequiredCredentialFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	return authtypes.ClientAuthenticationFields(oauthTokenConfig)
+}
+
+// Function to validate the device authorization specific configuration
+func (Handler) Validate(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	// With an issuer the device authorization endpoint is discovered
+	hasURL := oauthTokenConfig.Spec.DeviceCode != nil && oauthTokenConfig.Spec.DeviceCode.DeviceAuthorizationURL != ""
+	if !hasURL && oauthTokenConfig.Spec.IssuerURL == "" {
+		return fmt.Errorf("deviceCode.deviceAuthorizationUrl is required without issuerUrl")
+	}
+	return nil
+}
+
+// Function to get a new token, starts a device authorization or polls the token endpoint for a pending one
+func (h Handler) Acquire(ctx context.Context, grantRequest authtypes.GrantRequest) (*definitions.Tokens, error) {
+	log := log.FromContext(ctx)
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	name := types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}
+	state := grantRequest.State
+	if state == nil {
+		return nil, fmt.Errorf("the device authorization grant requires the grant state of the reconciler")
+	}
+	now := state.Clock()
+
+	deviceAuthorizationURL := grantRequest.Endpoints.DeviceAuthorization
+	if deviceAuthorizationURL == "" && oauthTokenConfig.Spec.DeviceCode != nil {
+		deviceAuthorizationURL = oauthTokenConfig.Spec.DeviceCode.DeviceAuthorizationURL
+	}
+	if deviceAuthorizationURL == "" {
+		return nil, fmt.Errorf("no device authorization endpoint configured or discovered")
+	}
+
+	authorization, _ := state.Load(name)
+	pending, ok := authorization.(deviceAuthorization)
+	if !ok || now.After(pending.expiresAt) || pending.deviceAuthorizationURL != deviceAuthorizationURL {
+		return nil, h.authorize(ctx, grantRequest, name, deviceAuthorizationURL, !ok)
+	}
+
+	// Reconciliations triggered by other events must not poll faster than the server allows
+	if now.Before(pending.nextPoll) {
+		return nil, &authtypes.AuthorizationPendingError{
+			Message:    "Waiting for the user to complete the device authorization",
+			RetryAfter: pending.nextPoll.Sub(now),
+		}
+	}
+
+	data := url.Values{}
+	data.Set(oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName, grantTypeURN)
+	data.Set("device_code", pending.deviceCode)
+	tokens, err := authtypes.GetToken(ctx, grantRequest, data)
+
+	// A held back poll keeps the device code for the next attempt
+	var throttledErr *authtypes.ThrottledError
+	if errors.As(err, &throttledErr) {
+		return nil, err
+	}
+	var errorResponse *authtypes.ErrorResponse
+	if err != nil && errors.As(err, &errorResponse) {
+		switch errorResponse.Code {
+		case "authorization_pending":
+			return nil, h.wait(state, name, pending, 0)
+		case "slow_down":
+			log.V(1).Info("Authorization server asked to slow down polling", "interval", pending.interval+slowDownInterval)
+			return nil, h.wait(state, name, pending, slowDownInterval)
+		}
+	}
+
+	// The device code is used up on success and on any other error, e.g. access_denied or expired_token
+	state.Forget(name)
+	if grantRequest.Status != nil {
+		grantRequest.Status.DeviceAuthorization = nil
+	}
+	return tokens, err
+}
+
+// Function to refresh the token using the refresh token issued after the device authorization
+func (Handler) Refresh(ctx context.Context, grantRequest authtypes.GrantRequest, refreshToken string) (*definitions.Tokens, error) {
+	return authtypes.RefreshWithToken(ctx, grantRequest, refreshToken)
+}
+
+// Function to start a device authorization and record the user code in the status, lost is set if no pending
+// authorization was kept for the resource
+func (h Handler) authorize(ctx context.Context, grantRequest authtypes.GrantRequest, name types.NamespacedName, deviceAuthorizationURL string, lost bool) error {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+
+	data := url.Values{}
+	if oauthTokenConfig.Spec.DeviceCode != nil && oauthTokenConfig.Spec.DeviceCode.Scope != "" {
+		data.Set("scope", oauthTokenConfig.Spec.DeviceCode.Scope)
+	}
+	if err := authtypes.ApplyTokenParameters(ctx, grantRequest, data); err != nil {
+		return err
+	}
+	responseBody, err := authtypes.SendRequest(ctx, grantRequest, deviceAuthorizationURL, data)
+	if err != nil {
+		return fmt.Errorf("device authorization request failed: %w", err)
+	}
+
+	var response deviceAuthorizationResponse
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return fmt.Errorf("failed to decode device authorization response: %w", err)
+	}
+	if response.DeviceCode == "" || response.UserCode == "" || response.VerificationURI == "" || response.ExpiresIn <= 0 {
+		return fmt.Errorf("device authorization response is missing device_code, user_code, verification_uri or expires_in")
+	}
+
+	interval := defaultInterval
+	if response.Interval > 0 {
+		interval = time.Duration(response.Interval) * time.Second
+	}
+	now := grantRequest.State.Clock()
+	authorization := deviceAuthorization{
+		deviceAuthorizationURL: deviceAuthorizationURL,
+		deviceCode:             response.DeviceCode,
+		interval:               interval,
+		expiresAt:              now.Add(time.Duration(response.ExpiresIn) * time.Second),
+		nextPoll:               now.Add(interval),
+	}
+	grantRequest.State.Store(name, authorization)
+
+	// An unexpired user code in the status was lost with the state, e.g. by a restart of the controller
+	reason := "DeviceAuthorizationStarted"
+	message := ""
+	if lost && grantRequest.Status != nil && grantRequest.Status.DeviceAuthorization != nil && now.Before(grantRequest.Status.DeviceAuthorization.ExpirationTime.Time) {
+		reason = "DeviceAuthorizationRestarted"
+		message = fmt.Sprintf("The pending device authorization with the code %s was lost, e.g. by a restart of the controller. ", grantRequest.Status.DeviceAuthorization.UserCode)
+	}
+	if grantRequest.Status != nil {
+		grantRequest.Status.DeviceAuthorization = &authv1alpha1.DeviceAuthorizationStatus{
+			UserCode:                response.UserCode,
+			VerificationURI:         response.VerificationURI,
+			VerificationURIComplete: response.VerificationURIComplete,
+			ExpirationTime:          metav1.NewTime(authorization.expiresAt),
+		}
+	}
+
+	verificationURI := response.VerificationURIComplete
+	if verificationURI == "" {
+		verificationURI = response.VerificationURI
+	}
+	return &authtypes.AuthorizationPendingError{
+		Reason:     reason,
+		Message:    message + fmt.Sprintf("Visit %s and enter the code %s before %s", verificationURI, response.UserCode, authorization.expiresAt.Format(time.RFC3339)),
+		RetryAfter: interval,
+	}
+}
+
+// Function to schedule the next poll of a pending authorization, optionally increasing the interval
+func (Handler) wait(state *authtypes.GrantState, name types.NamespacedName, authorization deviceAuthorization, increase time.Duration) error {
+	authorization.interval += increase
+	authorization.nextPoll = state.Clock().Add(authorization.interval)
+	state.Store(name, authorization)
+
+	return &authtypes.AuthorizationPendingError{
+		Message:    "Waiting for the user to complete the device authorization",
+		RetryAfter: authorization.interval,
+	}
+}
@@ -0,0 +1,172 @@
+package authtypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Well-known paths of OpenID Connect Discovery 1.0 and RFC 8414
+const (
+	openIDConfigurationPath            = "/.well-known/openid-configuration"
+	oauthAuthorizationServerPath       = "/.well-known/oauth-authorization-server"
+	metadataResponseBodyLimit    int64 = 1 << 20
+)
+
+// ProviderMetadata holds the parts of the authorization server metadata used by the controller
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Endpoints of the authorization server used for an OAuthTokenConfig, explicit URLs of the spec take precedence over discovered ones
+type Endpoints struct {
+	Token               string
+	Revocation          string
+	Introspection       string
+	DeviceAuthorization string
+	JWKS                string
+}
+
+// Function to fetch the metadata of an issuer, the OpenID Connect location is tried first and RFC 8414 second
+func FetchProviderMetadata(ctx context.Context, httpClient *http.Client, issuerURL string) (*ProviderMetadata, error) {
+	log := log.FromContext(ctx)
+
+	metadataURLs, err := metadataURLs(issuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := []string{}
+	for _, metadataURL := range metadataURLs {
+		metadata, err := fetchMetadataDocument(ctx, httpClient, metadataURL)
+		if err != nil {
+			log.V(1).Info("Failed to fetch authorization server metadata", "url", metadataURL, "error", err)
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		// The issuer in the metadata has to be the one it was fetched for (RFC 8414 section 3.3)
+		if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(issuerURL, "/") {
+			return nil, fmt.Errorf("issuer %s in the metadata of %s does not match", metadata.Issuer, metadataURL)
+		}
+		return metadata, nil
+	}
+	return nil, fmt.Errorf("failed to discover metadata of issuer %s: %s", issuerURL, strings.Join(errs, "; "))
+}
+
+// Function to build the metadata URLs of an issuer
+func metadataURLs(issuerURL string) ([]string, error) {
+	issuer, err := url.Parse(issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer URL %s: %w", issuerURL, err)
+	}
+	path := strings.TrimSuffix(issuer.Path, "/")
+
+	// OpenID Connect appends the well-known path, RFC 8414 inserts it between host and path
+	openIDConfiguration := *issuer
+	openIDConfiguration.Path = path + openIDConfigurationPath
+	oauthAuthorizationServer := *issuer
+	oauthAuthorizationServer.Path = oauthAuthorizationServerPath + path
+
+	return []string{openIDConfiguration.String(), oauthAuthorizationServer.String()}, nil
+}
+
+// Function to fetch and decode a single metadata document
+func fetchMetadataDocument(ctx context.Context, httpClient *http.Client, metadataURL string) (*ProviderMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 response from %s: %d", metadataURL, resp.StatusCode)
+	}
+
+	metadata := &ProviderMetadata{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, metadataResponseBodyLimit)).Decode(metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata from %s: %w", metadataURL, err)
+	}
+	if metadata.TokenEndpoint == "" {
+		return nil, fmt.Errorf("metadata from %s has no token_endpoint", metadataURL)
+	}
+	return metadata, nil
+}
+
+// Function to check that the server advertises the grant type and client authentication method of the OAuthTokenConfig.
+// Lists which the server does not publish are not checked: the defaults of RFC 8414, authorization_code and implicit
+// with client_secret_basic, would reject every grant type of the controller, while many servers simply omit the lists
+func ValidateProviderMetadata(oauthTokenConfig authv1alpha1.OAuthTokenConfig, metadata *ProviderMetadata) error {
+	handler, err := Lookup(oauthTokenConfig.Spec.Type)
+	if err != nil {
+		return err
+	}
+
+	grantType := handler.AdvertisedGrantType()
+	if len(metadata.GrantTypesSupported) > 0 && !slices.Contains(metadata.GrantTypesSupported, grantType) {
+		return fmt.Errorf("grant type %s is not supported by issuer %s, supported grant types: %s",
+			grantType, metadata.Issuer, strings.Join(metadata.GrantTypesSupported, ", "))
+	}
+
+	// A service account token is a JWT client assertion signed with a private key from the view of the server
+	method := ClientAuthenticationMethod(oauthTokenConfig)
+	if method == ClientAuthenticationServiceAccount {
+		method = ClientAuthenticationPrivateKeyJWT
+	}
+	if len(metadata.TokenEndpointAuthMethodsSupported) > 0 && !slices.Contains(metadata.TokenEndpointAuthMethodsSupported, method) {
+		return fmt.Errorf("client authentication method %s is not supported by issuer %s, supported methods: %s",
+			method, metadata.Issuer, strings.Join(metadata.TokenEndpointAuthMethodsSupported, ", "))
+	}
+	return nil
+}
+
+// Function to combine the explicit URLs of the spec with the discovered metadata, which may be nil
+func ResolveEndpoints(oauthTokenConfig authv1alpha1.OAuthTokenConfig, metadata *ProviderMetadata) (Endpoints, error) {
+	endpoints := Endpoints{}
+	if metadata != nil {
+		endpoints = Endpoints{
+			Token:               metadata.TokenEndpoint,
+			Revocation:          metadata.RevocationEndpoint,
+			Introspection:       metadata.IntrospectionEndpoint,
+			DeviceAuthorization: metadata.DeviceAuthorizationEndpoint,
+			JWKS:                metadata.JWKSURI,
+		}
+	}
+
+	if oauthTokenConfig.Spec.TokenURL != "" {
+		endpoints.Token = oauthTokenConfig.Spec.TokenURL
+	}
+	if oauthTokenConfig.Spec.RevocationURL != "" {
+		endpoints.Revocation = oauthTokenConfig.Spec.RevocationURL
+	}
+	if oauthTokenConfig.Spec.DeviceCode != nil && oauthTokenConfig.Spec.DeviceCode.DeviceAuthorizationURL != "" {
+		endpoints.DeviceAuthorization = oauthTokenConfig.Spec.DeviceCode.DeviceAuthorizationURL
+	}
+
+	if endpoints.Token == "" {
+		return endpoints, fmt.Errorf("either tokenUrl or issuerUrl is required")
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,110 @@
+package authtypes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+var _ = Describe("Authorization server discovery", func() {
+	var (
+		ctx      context.Context
+		server   *httptest.Server
+		metadata map[string]*ProviderMetadata
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		metadata = map[string]*ProviderMetadata{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			document, ok := metadata[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(document)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should fetch the OpenID Connect metadata of an issuer", func() {
+		issuer := server.URL + "/realms/test"
+		metadata["/realms/test/.well-known/openid-configuration"] = &ProviderMetadata{
+			Issuer:        issuer,
+			TokenEndpoint: issuer + "/token",
+		}
+
+		discovered, err := FetchProviderMetadata(ctx, server.Client(), issuer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(discovered.TokenEndpoint).To(Equal(issuer + "/token"))
+	})
+
+	It("should fall back to the RFC 8414 metadata location", func() {
+		issuer := server.URL + "/tenant"
+		metadata["/.well-known/oauth-authorization-server/tenant"] = &ProviderMetadata{
+			Issuer:             issuer,
+			TokenEndpoint:      issuer + "/token",
+			RevocationEndpoint: issuer + "/revoke",
+		}
+
+		discovered, err := FetchProviderMetadata(ctx, server.Client(), issuer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(discovered.RevocationEndpoint).To(Equal(issuer + "/revoke"))
+	})
+
+	It("should reject metadata of another issuer", func() {
+		metadata["/.well-known/openid-configuration"] = &ProviderMetadata{
+			Issuer:        "https://other.example.com",
+			TokenEndpoint: "https://other.example.com/token",
+		}
+
+		_, err := FetchProviderMetadata(ctx, server.Client(), server.URL)
+		Expect(err).To(MatchError(ContainSubstring("does not match")))
+	})
+
+	It("should validate the grant type and client authentication method against the metadata", func() {
+		oauthTokenConfig := authv1alpha1.OAuthTokenConfig{
+			Spec: authv1alpha1.OAuthTokenConfigSpec{Type: "client_credentials"},
+		}
+		discovered := &ProviderMetadata{
+			Issuer:                            "https://issuer.example.com",
+			GrantTypesSupported:               []string{"client_credentials"},
+			TokenEndpointAuthMethodsSupported: []string{ClientAuthenticationSecretPost},
+		}
+		Expect(ValidateProviderMetadata(oauthTokenConfig, discovered)).To(Succeed())
+
+		discovered.GrantTypesSupported = []string{"authorization_code"}
+		Expect(ValidateProviderMetadata(oauthTokenConfig, discovered)).To(MatchError(ContainSubstring("grant type client_credentials is not supported")))
+
+		// Lists the server does not publish are not checked
+		discovered.GrantTypesSupported = nil
+		discovered.TokenEndpointAuthMethodsSupported = nil
+		Expect(ValidateProviderMetadata(oauthTokenConfig, discovered)).To(Succeed())
+	})
+
+	It("should prefer the explicit URLs of the spec over discovered endpoints", func() {
+		oauthTokenConfig := authv1alpha1.OAuthTokenConfig{
+			Spec: authv1alpha1.OAuthTokenConfigSpec{TokenURL: "https://override.example.com/token"},
+		}
+		endpoints, err := ResolveEndpoints(oauthTokenConfig, &ProviderMetadata{
+			TokenEndpoint:      "https://issuer.example.com/token",
+			RevocationEndpoint: "https://issuer.example.com/revoke",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoints.Token).To(Equal("https://override.example.com/token"))
+		Expect(endpoints.Revocation).To(Equal("https://issuer.example.com/revoke"))
+
+		_, err = ResolveEndpoints(authv1alpha1.OAuthTokenConfig{}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,184 @@
+package authtypes
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Supported JWT signing algorithms
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmPS256 = "PS256"
+	SigningAlgorithmES256 = "ES256"
+	SigningAlgorithmHS256 = "HS256"
+)
+
+// Function to build the standard claims of an assertion, extra claims override the standard ones
+func AssertionClaims(issuer, subject, audience string, lifetime time.Duration, extraClaims map[string]string) (map[string]interface{}, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": issuer,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+		"jti": hex.EncodeToString(jti),
+	}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+	return claims, nil
+}
+
+// Function to sign the given claims as compact JWS with a PEM encoded private key
+func SignJWT(claims map[string]interface{}, algorithm string, privateKeyPEM []byte, keyID string) (string, error) {
+	privateKey, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	header := map[string]interface{}{
+		"alg": algorithm,
+		"typ": "JWT",
+	}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	signingInput, err := encodeSegments(header, claims)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch algorithm {
+	case SigningAlgorithmRS256, SigningAlgorithmPS256:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("signing algorithm %s requires an RSA private key", algorithm)
+		}
+		if algorithm == SigningAlgorithmRS256 {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		} else {
+			signature, err = rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case SigningAlgorithmES256:
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve.Params().BitSize != 256 {
+			return "", fmt.Errorf("signing algorithm %s requires a P-256 EC private key", algorithm)
+		}
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err == nil {
+			// JWS uses the fixed size concatenation of r and s instead of ASN.1 (RFC 7518 section 3.4)
+			signature = make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+		}
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Function to sign the given claims as compact JWS with HS256 using a shared secret
+func SignJWTWithSecret(claims map[string]interface{}, secret []byte) (string, error) {
+	if len(secret) == 0 {
+		return "", fmt.Errorf("signing algorithm %s requires a secret", SigningAlgorithmHS256)
+	}
+
+	header := map[string]interface{}{
+		"alg": SigningAlgorithmHS256,
+		"typ": "JWT",
+	}
+	signingInput, err := encodeSegments(header, claims)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Function to encode header and claims as the signing input of a JWS
+func encodeSegments(header, claims map[string]interface{}) (string, error) {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON), nil
+}
+
+// Function to parse a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key
+func parsePrivateKey(privateKeyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key of PEM type %s", block.Type)
+}
+
+// Function to read the exp claim of a JWT without verifying it, zero if the token is no JWT or has no exp claim
+func JWTExpiration(token string) time.Time {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == "" {
+		return time.Time{}
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil || exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
@@ -0,0 +1,116 @@
+package authtypes
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWT signing", func() {
+	var (
+		rsaKey    *rsa.PrivateKey
+		rsaKeyPEM []byte
+		ecKey     *ecdsa.PrivateKey
+		ecKeyPEM  []byte
+		claims    map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		var err error
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		rsaKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		ecKeyBytes, err := x509.MarshalPKCS8PrivateKey(ecKey)
+		Expect(err).NotTo(HaveOccurred())
+		ecKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecKeyBytes})
+
+		claims, err = AssertionClaims("test-issuer", "test-subject", "https://example.com/oauth/token", time.Minute, map[string]string{"scope": "read"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// Function to split a compact JWS and return the decoded header, claims, signing input digest and signature
+	decode := func(token string) (map[string]interface{}, map[string]interface{}, []byte, []byte) {
+		parts := strings.Split(token, ".")
+		Expect(parts).To(HaveLen(3))
+
+		header := map[string]interface{}{}
+		headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(headerJSON, &header)).To(Succeed())
+
+		payload := map[string]interface{}{}
+		payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(payloadJSON, &payload)).To(Succeed())
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		Expect(err).NotTo(HaveOccurred())
+
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		return header, payload, digest[:], signature
+	}
+
+	It("should sign the assertion with RS256", func() {
+		token, err := SignJWT(claims, SigningAlgorithmRS256, rsaKeyPEM, "test-kid")
+		Expect(err).NotTo(HaveOccurred())
+
+		header, payload, digest, signature := decode(token)
+		Expect(header).To(HaveKeyWithValue("alg", "RS256"))
+		Expect(header).To(HaveKeyWithValue("kid", "test-kid"))
+		Expect(payload).To(HaveKeyWithValue("iss", "test-issuer"))
+		Expect(payload).To(HaveKeyWithValue("sub", "test-subject"))
+		Expect(payload).To(HaveKeyWithValue("aud", "https://example.com/oauth/token"))
+		Expect(payload).To(HaveKeyWithValue("scope", "read"))
+		Expect(payload).To(HaveKey("exp"))
+		Expect(payload).To(HaveKey("jti"))
+		Expect(rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, signature)).To(Succeed())
+	})
+
+	It("should sign the assertion with PS256", func() {
+		token, err := SignJWT(claims, SigningAlgorithmPS256, rsaKeyPEM, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		header, _, digest, signature := decode(token)
+		Expect(header).To(HaveKeyWithValue("alg", "PS256"))
+		Expect(header).NotTo(HaveKey("kid"))
+		Expect(rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})).To(Succeed())
+	})
+
+	It("should sign the assertion with ES256", func() {
+		token, err := SignJWT(claims, SigningAlgorithmES256, ecKeyPEM, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		header, _, digest, signature := decode(token)
+		Expect(header).To(HaveKeyWithValue("alg", "ES256"))
+		Expect(signature).To(HaveLen(64))
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		Expect(ecdsa.Verify(&ecKey.PublicKey, digest, r, s)).To(BeTrue())
+	})
+
+	It("should reject a key which does not match the algorithm", func() {
+		_, err := SignJWT(claims, SigningAlgorithmES256, rsaKeyPEM, "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject keys which are not PEM encoded", func() {
+		_, err := SignJWT(claims, SigningAlgorithmRS256, []byte("not a key"), "")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,141 @@
+package jwtbearer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+)
+
+// GrantType is the name under which the JWT bearer grant is registered
+const GrantType = "jwt-bearer"
+
+// Grant type URN defined in RFC 7523 section 2.1
+const grantTypeURN = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// Defaults used if the jwtBearer section is omitted
+const (
+	defaultLifetime         = 5 * time.Minute
+	defaultSigningAlgorithm = authtypes.SigningAlgorithmRS256
+)
+
+func init() {
+	authtypes.Register(GrantType, Handler{})
+}
+
+// Handler implements the JWT bearer assertion grant (RFC 7523)
+type Handler struct{}
+
+// Function to get the grant_type value of the JWT bearer grant
+func (Handler) AdvertisedGrantType() string {
+	return grantTypeURN
+}
+
+// Function to list the credentials required by the JWT bearer grant
+func (Handler) RequiredCredentialFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	fields := []string{}
+
+	// A service account token replaces the signed assertion, so neither private key nor issuer are needed
+	if oauthTokenConfig.Spec.ServiceAccountToken == nil {
+		fields = append(fields, oauthTokenConfig.Spec.Credentials.PrivateKeyFieldName)
+
+		// Without an explicit issuer the client ID is used as issuer
+		if oauthTokenConfig.Spec.JWTBearer == nil || oauthTokenConfig.Spec.JWTBearer.Issuer == "" {
+			fields = append(fields, oauthTokenConfig.Spec.Credentials.ClientIDFieldName)
+		}
+	}
+
+	// Client authentication is optional for this grant (RFC 7523 section 2.1), by default only what is present is sent
+	if oauthTokenConfig.Spec.ClientAuthentication != nil {
+		fields = append(fields, authtypes.ClientAuthenticationFields(oauthTokenConfig)...)
+	}
+	return fields
+}
+
+// Function to validate the JWT bearer specific configuration
+func (Handler) Validate(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	jwtBearer := oauthTokenConfig.Spec.JWTBearer
+	if jwtBearer == nil {
+		return nil
+	}
+	if jwtBearer.Lifetime != nil && jwtBearer.Lifetime.Duration <= 0 {
+		return fmt.Errorf("jwtBearer.lifetime must be positive")
+	}
+	return nil
+}
+
+// Function to get a new token by exchanging a freshly signed assertion or a bound service account token
+func (Handler) Acquire(ctx context.Context, grantRequest authtypes.GrantRequest) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+
+	var assertion string
+	var err error
+	if oauthTokenConfig.Spec.ServiceAccountToken != nil {
+		assertion, err = authtypes.ServiceAccountToken(ctx, grantRequest)
+	} else {
+		assertion, err = buildAssertion(grantRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set(oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName, grantTypeURN)
+	data.Set(oauthTokenConfig.Spec.TokenRequest.AssertionFieldName, assertion)
+
+	return authtypes.GetToken(ctx, grantRequest, data)
+}
+
+// Function to refresh the token, a new assertion is signed on every refresh instead of using a refresh token
+func (h Handler) Refresh(ctx context.Context, grantRequest authtypes.GrantRequest, refreshToken string) (*definitions.Tokens, error) {
+	return h.Acquire(ctx, grantRequest)
+}
+
+// Function to build and sign the assertion from the jwtBearer config and the credentials secret
+func buildAssertion(grantRequest authtypes.GrantRequest) (string, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	credentials := grantRequest.CredentialsSecret.Data
+
+	jwtBearer := authv1alpha1.JWTBearerConfig{}
+	if oauthTokenConfig.Spec.JWTBearer != nil {
+		jwtBearer = *oauthTokenConfig.Spec.JWTBearer
+	}
+
+	issuer := jwtBearer.Issuer
+	if issuer == "" {
+		issuer = string(credentials[oauthTokenConfig.Spec.Credentials.ClientIDFieldName])
+	}
+	subject := jwtBearer.Subject
+	if subject == "" {
+		subject = issuer
+	}
+	audience := jwtBearer.Audience
+	if audience == "" {
+		audience = grantRequest.TokenURL()
+	}
+	lifetime := defaultLifetime
+	if jwtBearer.Lifetime != nil {
+		lifetime = jwtBearer.Lifetime.Duration
+	}
+	signingAlgorithm := jwtBearer.SigningAlgorithm
+	if signingAlgorithm == "" {
+		signingAlgorithm = defaultSigningAlgorithm
+	}
+
+	claims, err := authtypes.AssertionClaims(issuer, subject, audience, lifetime, jwtBearer.Claims)
+	if err != nil {
+		return "", err
+	}
+
+	privateKey := credentials[oauthTokenConfig.Spec.Credentials.PrivateKeyFieldName]
+	keyID := string(credentials[oauthTokenConfig.Spec.Credentials.KeyIDFieldName])
+	assertion, err := authtypes.SignJWT(claims, signingAlgorithm, privateKey, keyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to build assertion: %w", err)
+	}
+	return assertion, nil
+}
@@ -0,0 +1,74 @@
+package authtypes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Function to add the scope, audience, resource and extra parameters of the token request configuration,
+// parameters which are already set by the grant type are kept
+func ApplyTokenParameters(ctx context.Context, grantRequest GrantRequest, data url.Values) error {
+	tokenRequest := grantRequest.OAuthTokenConfig.Spec.TokenRequest
+
+	if tokenRequest.Scope != "" && !data.Has("scope") {
+		data.Set("scope", tokenRequest.Scope)
+	}
+	if !data.Has("audience") {
+		for _, audience := range tokenRequest.Audience {
+			data.Add("audience", audience)
+		}
+	}
+	if !data.Has("resource") {
+		for _, resource := range tokenRequest.Resource {
+			data.Add("resource", resource)
+		}
+	}
+
+	// Sorted for a stable request, secrets are only read for parameters which are actually sent
+	names := make([]string, 0, len(tokenRequest.ExtraParameters))
+	for name := range tokenRequest.ExtraParameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if data.Has(name) {
+			continue
+		}
+		value, err := parameterValue(ctx, grantRequest, tokenRequest.ExtraParameters[name])
+		if err != nil {
+			return fmt.Errorf("failed to resolve parameter %s: %w", name, err)
+		}
+		data.Set(name, value)
+	}
+	return nil
+}
+
+// Function to resolve the value of an extra parameter
+func parameterValue(ctx context.Context, grantRequest GrantRequest, parameter authv1alpha1.ParameterValue) (string, error) {
+	if parameter.SecretKeyRef == nil {
+		return parameter.Value, nil
+	}
+
+	secretName := types.NamespacedName{
+		Name:      parameter.SecretKeyRef.Name,
+		Namespace: parameter.SecretKeyRef.Namespace,
+	}
+	if secretName.Namespace == "" {
+		secretName.Namespace = grantRequest.OAuthTokenConfig.Namespace
+	}
+	secret := &corev1.Secret{}
+	if err := grantRequest.KubeClient.Get(ctx, secretName, secret); err != nil {
+		return "", fmt.Errorf("failed to fetch secret %s: %w", secretName, err)
+	}
+	value, ok := secret.Data[parameter.SecretKeyRef.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", secretName, parameter.SecretKeyRef.Key)
+	}
+	return string(value), nil
+}
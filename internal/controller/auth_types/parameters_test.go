@@ -0,0 +1,81 @@
+package authtypes
+
+import (
+	"context"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+var _ = Describe("Token request parameters", func() {
+	var (
+		ctx          context.Context
+		grantRequest GrantRequest
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		grantRequest = GrantRequest{
+			KubeClient: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "params", Namespace: "default"},
+				Data:       map[string][]byte{"tenant": []byte("secret-tenant")},
+			}).Build(),
+			OAuthTokenConfig: authv1alpha1.OAuthTokenConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+				Spec: authv1alpha1.OAuthTokenConfigSpec{
+					TokenRequest: authv1alpha1.TokenRequestConfig{
+						Scope:    "read write",
+						Audience: []string{"https://api.example.com", "https://other.example.com"},
+						Resource: []string{"https://resource.example.com"},
+						ExtraParameters: map[string]authv1alpha1.ParameterValue{
+							"prompt": {Value: "none"},
+							"tenant": {SecretKeyRef: &authv1alpha1.SecretKeyReference{Name: "params", Key: "tenant"}},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	It("should add the scope, audience, resource and extra parameters", func() {
+		data := url.Values{}
+		Expect(ApplyTokenParameters(ctx, grantRequest, data)).To(Succeed())
+		Expect(data.Get("scope")).To(Equal("read write"))
+		Expect(data["audience"]).To(ConsistOf("https://api.example.com", "https://other.example.com"))
+		Expect(data["resource"]).To(ConsistOf("https://resource.example.com"))
+		Expect(data.Get("prompt")).To(Equal("none"))
+		Expect(data.Get("tenant")).To(Equal("secret-tenant"))
+	})
+
+	It("should keep parameters set by the grant type", func() {
+		data := url.Values{}
+		data.Set("scope", "exchange")
+		data.Set("prompt", "login")
+		Expect(ApplyTokenParameters(ctx, grantRequest, data)).To(Succeed())
+		Expect(data.Get("scope")).To(Equal("exchange"))
+		Expect(data.Get("prompt")).To(Equal("login"))
+	})
+
+	It("should fail if the secret of a parameter does not exist", func() {
+		grantRequest.OAuthTokenConfig.Spec.TokenRequest.ExtraParameters["tenant"] = authv1alpha1.ParameterValue{
+			SecretKeyRef: &authv1alpha1.SecretKeyReference{Name: "missing", Key: "tenant"},
+		}
+		Expect(ApplyTokenParameters(ctx, grantRequest, url.Values{})).To(MatchError(ContainSubstring("failed to resolve parameter tenant")))
+	})
+
+	It("should record the granted scope of the token response", func() {
+		tokens, err := ParseTokenResponse(authv1alpha1.OAuthTokenConfig{
+			Spec: authv1alpha1.OAuthTokenConfigSpec{
+				TokenResponse: authv1alpha1.TokenResponseConfig{AccessTokenFieldName: "access_token", ExpirationFieldName: "expires_in"},
+			},
+		}, []byte(`{"access_token": "token", "expires_in": 60, "scope": "read"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.Scope).To(Equal("read"))
+	})
+})
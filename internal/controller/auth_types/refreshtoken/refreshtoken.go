@@ -0,0 +1,117 @@
+package refreshtoken
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// GrantType is the name under which the refresh token grant is registered
+const GrantType = "refresh_token"
+
+func init() {
+	authtypes.Register(GrantType, Handler{})
+}
+
+// Handler implements a token chain seeded with a refresh token from the credentials secret,
+// e.g. one obtained through an authorization code login, no password is ever needed
+type Handler struct{}
+
+// Function to get the grant_type value of the refresh token grant
+func (Handler) AdvertisedGrantType() string {
+	return "refresh_token"
+}
+
+// Function to list the credentials required by the refresh token grant, the seed itself is optional
+// as long as the target secret holds a valid refresh token
+func (Handler) RequiredCredentialFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	return authtypes.ClientAuthenticationFields(oauthTokenConfig)
+}
+
+// Function to validate the refresh token specific configuration
+func (Handler) Validate(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	return nil
+}
+
+// Function to start the token chain with the refresh token from the credentials secret, without an unused one
+// the chain of the target secret is continued, e.g. if only the client secret was rotated
+func (h Handler) Acquire(ctx context.Context, grantRequest authtypes.GrantRequest) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	seed := string(grantRequest.CredentialsSecret.Data[oauthTokenConfig.Spec.Credentials.RefreshTokenFieldName])
+	refreshToken := string(grantRequest.TargetSecret.Data[oauthTokenConfig.Spec.Target.RefreshTokenFieldName])
+	seedUsed := seed == "" || hash(seed) == oauthTokenConfig.Status.SeedRefreshTokenHash
+	if seedUsed && refreshToken != "" && oauthTokenConfig.Status.Status != definitions.STATUS_REAUTHENTICATION_REQUIRED {
+		tokens, err := authtypes.RefreshWithToken(ctx, grantRequest, refreshToken)
+		var errorResponse *authtypes.ErrorResponse
+		if errors.As(err, &errorResponse) && errorResponse.Rejected() {
+			return nil, &authtypes.ReauthenticationRequiredError{
+				Message: fmt.Sprintf("the refresh token in the target secret was rejected and the credentials secret holds no unused one: %v", err),
+			}
+		}
+		return tokens, err
+	}
+	return h.acquireWithSeed(ctx, grantRequest)
+}
+
+// Function to start the token chain with the refresh token from the credentials secret
+func (Handler) acquireWithSeed(ctx context.Context, grantRequest authtypes.GrantRequest) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	seed := string(grantRequest.CredentialsSecret.Data[oauthTokenConfig.Spec.Credentials.RefreshTokenFieldName])
+	if seed == "" {
+		return nil, &authtypes.ReauthenticationRequiredError{
+			Message: fmt.Sprintf("no refresh token in field %s of the credentials secret", oauthTokenConfig.Spec.Credentials.RefreshTokenFieldName),
+		}
+	}
+
+	// With refresh token rotation a used seed is invalid, presenting it again may revoke the whole chain
+	seedHash := hash(seed)
+	if seedHash == oauthTokenConfig.Status.SeedRefreshTokenHash {
+		return nil, &authtypes.ReauthenticationRequiredError{
+			Message: "the refresh token chain is broken and the refresh token in the credentials secret was already used, a new one is required",
+		}
+	}
+
+	tokens, err := authtypes.RefreshWithToken(ctx, grantRequest, seed)
+	if err != nil {
+		var errorResponse *authtypes.ErrorResponse
+		if errors.As(err, &errorResponse) && errorResponse.Rejected() {
+			if grantRequest.Status != nil {
+				grantRequest.Status.SeedRefreshTokenHash = seedHash
+			}
+			return nil, &authtypes.ReauthenticationRequiredError{
+				Message: fmt.Sprintf("the refresh token in the credentials secret was rejected: %v", err),
+			}
+		}
+		return nil, err
+	}
+
+	if grantRequest.Status != nil {
+		grantRequest.Status.SeedRefreshTokenHash = seedHash
+	}
+	return tokens, nil
+}
+
+// Function to continue the token chain with the refresh token from the target secret,
+// falls back to an unused seed from the credentials secret if it is rejected
+func (h Handler) Refresh(ctx context.Context, grantRequest authtypes.GrantRequest, refreshToken string) (*definitions.Tokens, error) {
+	tokens, err := authtypes.RefreshWithToken(ctx, grantRequest, refreshToken)
+	var errorResponse *authtypes.ErrorResponse
+	if errors.As(err, &errorResponse) && errorResponse.Rejected() {
+		log.FromContext(ctx).Info("Refresh token was rejected, falling back to the credentials secret", "error", err)
+		return h.acquireWithSeed(ctx, grantRequest)
+	}
+	return tokens, err
+}
+
+// Function to hash a refresh token, only the hash is kept in the status
+func hash(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,151 @@
+package authtypes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GrantRequest bundles everything a grant handler needs to talk to the authorization server
+type GrantRequest struct {
+	HTTPClient        *http.Client
+	KubeClient        client.Client
+	OAuthTokenConfig  authv1alpha1.OAuthTokenConfig
+	TargetSecret      corev1.Secret
+	CredentialsSecret corev1.Secret
+
+	// Status of the OAuthTokenConfig, grant handlers may record progress in it which the reconciler persists
+	Status *authv1alpha1.OAuthTokenConfigStatus
+
+	// Endpoints resolved from the spec and the discovered metadata of the issuer
+	Endpoints Endpoints
+
+	// State of grants spanning several reconciliations, kept by the reconciler
+	State *GrantState
+
+	// Admits a request to an endpoint right before it is sent, e.g. to the rate limit of its host. A request which has
+	// to wait is not sent and the ThrottledError is returned to the reconciler. Every request is sent if it is nil
+	Admit func(endpointURL string) error
+}
+
+// Function to get the token endpoint, falls back to the tokenUrl of the spec if no endpoints were resolved
+func (g GrantRequest) TokenURL() string {
+	if g.Endpoints.Token != "" {
+		return g.Endpoints.Token
+	}
+	return g.OAuthTokenConfig.Spec.TokenURL
+}
+
+// AuthorizationPendingError is returned by grant handlers waiting for an action outside of the controller,
+// e.g. the user completing a device authorization, the reconciler retries after RetryAfter without failing
+type AuthorizationPendingError struct {
+	// Reason of the event emitted for the pending authorization, no event is emitted without a reason
+	Reason     string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *AuthorizationPendingError) Error() string {
+	return e.Message
+}
+
+// ThrottledError is returned instead of sending a request which the Admit function of the GrantRequest held back,
+// the reconciler retries after RetryAfter without failing
+type ThrottledError struct {
+	// Reason of the Throttled condition
+	Reason     string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return e.Message
+}
+
+// ReauthenticationRequiredError is returned by grant handlers which cannot get a token without new credentials,
+// e.g. a rejected refresh token, the reconciler stops retrying the token request until the credentials change
+type ReauthenticationRequiredError struct {
+	Message string
+}
+
+func (e *ReauthenticationRequiredError) Error() string {
+	return e.Message
+}
+
+// GrantHandler is implemented by every supported OAuth2 grant type
+type GrantHandler interface {
+	// AdvertisedGrantType returns the grant_type value authorization servers list in their grant_types_supported metadata
+	AdvertisedGrantType() string
+
+	// RequiredCredentialFields returns the fields which have to be present in the credentials secret
+	RequiredCredentialFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string
+
+	// Validate checks the grant specific parts of the OAuthTokenConfig spec
+	Validate(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error
+
+	// Acquire requests a new token without a refresh token
+	Acquire(ctx context.Context, grantRequest GrantRequest) (*definitions.Tokens, error)
+
+	// Refresh requests a new token using the given refresh token
+	Refresh(ctx context.Context, grantRequest GrantRequest, refreshToken string) (*definitions.Tokens, error)
+}
+
+// SubjectTokenProvider is implemented by grant handlers deriving their token from another token,
+// the reconciler requests a new token as soon as the subject token changes
+type SubjectTokenProvider interface {
+	// SubjectToken returns the current subject token
+	SubjectToken(ctx context.Context, grantRequest GrantRequest) (string, error)
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]GrantHandler{}
+)
+
+// Register makes a grant handler available under the given grant type name, it panics on duplicate names.
+// The name also has to be added to the enum of OAuthTokenConfigSpec.Type, registry_test.go checks that both agree.
+func Register(name string, handler GrantHandler) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if handler == nil {
+		panic(fmt.Sprintf("grant handler for type %s is nil", name))
+	}
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("grant handler for type %s is already registered", name))
+	}
+	registry[name] = handler
+}
+
+// Lookup returns the grant handler registered for the given grant type name
+func Lookup(name string) (GrantHandler, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	handler, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported OAuth2 grant type: %s", name)
+	}
+	return handler, nil
+}
+
+// Names returns the sorted names of all registered grant types
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,51 @@
+package authtypes_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/clientcredentials"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/devicecode"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/jwtbearer"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/refreshtoken"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/ropc"
+	_ "github.com/winklermichael/otto/internal/controller/auth_types/tokenexchange"
+)
+
+var _ = Describe("Grant type registry", func() {
+	It("should return an error for unknown grant types", func() {
+		_, err := authtypes.Lookup("unknown")
+		Expect(err).To(MatchError(ContainSubstring("Unsupported OAuth2 grant type")))
+	})
+
+	It("should panic when a grant type is registered twice", func() {
+		handler, err := authtypes.Lookup("ropc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(func() { authtypes.Register("ropc", handler) }).To(Panic())
+	})
+
+	It("should match the grant type enum of the CRD", func() {
+		crdBytes, err := os.ReadFile(filepath.Join("..", "..", "..", "config", "crd", "bases", "auth.example.com_oauthtokenconfigs.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		crd := apiextensionsv1.CustomResourceDefinition{}
+		Expect(yaml.Unmarshal(crdBytes, &crd)).To(Succeed())
+		Expect(crd.Spec.Versions).NotTo(BeEmpty())
+
+		typeSchema := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties["type"]
+		enum := []string{}
+		for _, value := range typeSchema.Enum {
+			var name string
+			Expect(yaml.Unmarshal(value.Raw, &name)).To(Succeed())
+			enum = append(enum, name)
+		}
+
+		Expect(enum).To(ConsistOf(authtypes.Names()))
+	})
+})
@@ -0,0 +1,100 @@
+package authtypes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+// Supported content types of the token request
+const (
+	ContentTypeForm = "application/x-www-form-urlencoded"
+	ContentTypeJSON = "application/json"
+)
+
+// Function to build the token request according to the configured method and content type
+func BuildTokenRequest(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, tokenURL string, data url.Values) (*http.Request, error) {
+	method := oauthTokenConfig.Spec.TokenRequest.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	contentType := oauthTokenConfig.Spec.TokenRequest.ContentType
+	if contentType == "" {
+		contentType = ContentTypeForm
+	}
+
+	var body io.Reader
+	switch method {
+	case http.MethodGet:
+		// GET requests carry the parameters in the query string, merged with any query already present in the URL
+		parsedURL, err := url.Parse(tokenURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token URL: %w", err)
+		}
+		query := parsedURL.Query()
+		for key, values := range data {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		parsedURL.RawQuery = query.Encode()
+		tokenURL = parsedURL.String()
+	case http.MethodPost:
+		encoded, err := encodeBody(contentType, data)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+	default:
+		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, tokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only requests with a body have a content type
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", ContentTypeJSON)
+
+	// Set additional headers if provided
+	for key, value := range oauthTokenConfig.Spec.TokenRequest.Headers {
+		req.Header.Set(key, value)
+	}
+
+	return req, nil
+}
+
+// Function to encode the request parameters as the body of the given content type
+func encodeBody(contentType string, data url.Values) ([]byte, error) {
+	switch contentType {
+	case ContentTypeForm:
+		return []byte(data.Encode()), nil
+	case ContentTypeJSON:
+		// Single values are sent as JSON strings, repeated parameters as arrays
+		object := make(map[string]interface{}, len(data))
+		for key, values := range data {
+			if len(values) == 1 {
+				object[key] = values[0]
+			} else {
+				object[key] = values
+			}
+		}
+		encoded, err := json.Marshal(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode JSON request body: %w", err)
+		}
+		return encoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+}
@@ -0,0 +1,86 @@
+package authtypes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+var _ = Describe("Token request builder", func() {
+	const tokenURL = "https://example.com/oauth/token?realm=test"
+
+	var (
+		ctx              context.Context
+		oauthTokenConfig authv1alpha1.OAuthTokenConfig
+		data             url.Values
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		oauthTokenConfig = authv1alpha1.OAuthTokenConfig{
+			Spec: authv1alpha1.OAuthTokenConfigSpec{
+				TokenRequest: authv1alpha1.TokenRequestConfig{
+					Method:      "POST",
+					ContentType: ContentTypeForm,
+					Headers:     map[string]string{"X-Custom": "value"},
+				},
+			},
+		}
+		data = url.Values{}
+		data.Set("grant_type", "client_credentials")
+		data.Set("client_id", "test-client-id")
+	})
+
+	It("should send the parameters as a form body", func() {
+		req, err := BuildTokenRequest(ctx, oauthTokenConfig, tokenURL, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Method).To(Equal("POST"))
+		Expect(req.Header.Get("Content-Type")).To(Equal(ContentTypeForm))
+		Expect(req.Header.Get("X-Custom")).To(Equal("value"))
+
+		body, err := io.ReadAll(req.Body)
+		Expect(err).NotTo(HaveOccurred())
+		form, err := url.ParseQuery(string(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(form.Get("grant_type")).To(Equal("client_credentials"))
+		Expect(form.Get("client_id")).To(Equal("test-client-id"))
+	})
+
+	It("should send the parameters as a JSON object", func() {
+		oauthTokenConfig.Spec.TokenRequest.ContentType = ContentTypeJSON
+		req, err := BuildTokenRequest(ctx, oauthTokenConfig, tokenURL, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Header.Get("Content-Type")).To(Equal(ContentTypeJSON))
+
+		var body map[string]interface{}
+		Expect(json.NewDecoder(req.Body).Decode(&body)).To(Succeed())
+		Expect(body).To(HaveKeyWithValue("grant_type", "client_credentials"))
+		Expect(body).To(HaveKeyWithValue("client_id", "test-client-id"))
+	})
+
+	It("should send the parameters as a query string for GET requests", func() {
+		oauthTokenConfig.Spec.TokenRequest.Method = "GET"
+		req, err := BuildTokenRequest(ctx, oauthTokenConfig, tokenURL, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Method).To(Equal("GET"))
+		Expect(req.Body).To(BeNil())
+		Expect(req.Header.Get("Content-Type")).To(BeEmpty())
+
+		query := req.URL.Query()
+		Expect(query.Get("realm")).To(Equal("test"))
+		Expect(query.Get("grant_type")).To(Equal("client_credentials"))
+		Expect(query.Get("client_id")).To(Equal("test-client-id"))
+	})
+
+	It("should reject unsupported content types", func() {
+		oauthTokenConfig.Spec.TokenRequest.ContentType = "text/plain"
+		_, err := BuildTokenRequest(ctx, oauthTokenConfig, tokenURL, data)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,92 @@
+package authtypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Function to look up a field of a decoded JSON response. The path is either a top-level key, a dotted path like
+// result.accessToken or a JSONPath expression like {.result.accessToken} or $.result.accessToken
+func ResponseField(response map[string]interface{}, path string) (interface{}, bool, error) {
+	// A top-level key wins, so keys containing dots keep working. A null value counts as missing
+	if value, ok := response[path]; ok && value != nil {
+		return value, true, nil
+	}
+
+	parser := jsonpath.New(path).AllowMissingKeys(true)
+	if err := parser.Parse(jsonPathTemplate(path)); err != nil {
+		return nil, false, fmt.Errorf("invalid response field path '%s': %w", path, err)
+	}
+	results, err := parser.FindResults(response)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to evaluate response field path '%s': %w", path, err)
+	}
+	if len(results) == 0 || len(results[0]) == 0 {
+		return nil, false, nil
+	}
+	value := results[0][0]
+	if !value.IsValid() || !value.CanInterface() || value.Interface() == nil {
+		return nil, false, nil
+	}
+	return value.Interface(), true, nil
+}
+
+// Function to convert a path into the template syntax of the jsonpath package
+func jsonPathTemplate(path string) string {
+	switch {
+	case strings.HasPrefix(path, "{"):
+		return path
+	case strings.HasPrefix(path, "$"):
+		return "{" + strings.TrimPrefix(path, "$") + "}"
+	default:
+		return "{." + path + "}"
+	}
+}
+
+// Function to coerce a response value into a string, numbers and booleans are formatted
+func StringValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("value of type %T is not a string", value)
+	}
+}
+
+// Function to coerce a response value into an integer, numeric strings like "3600" are accepted
+func IntValue(value interface{}) (int, error) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return 0, err
+		}
+		number = parsed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("value '%s' is not a number", v)
+		}
+		number = parsed
+	default:
+		return 0, fmt.Errorf("value of type %T is not a number", value)
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("value %v is not a finite number", number)
+	}
+	return int(number), nil
+}
@@ -0,0 +1,145 @@
+package authtypes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+var _ = Describe("Token response parsing", func() {
+	var oauthTokenConfig authv1alpha1.OAuthTokenConfig
+
+	BeforeEach(func() {
+		oauthTokenConfig = authv1alpha1.OAuthTokenConfig{
+			Spec: authv1alpha1.OAuthTokenConfigSpec{
+				TokenResponse: authv1alpha1.TokenResponseConfig{
+					AccessTokenFieldName:       "access_token",
+					RefreshTokenFieldName:      "refresh_token",
+					ExpirationFieldName:        "expires_in",
+					RefreshExpirationFieldName: "refresh_expires_in",
+				},
+			},
+		}
+	})
+
+	It("should read fields of nested objects with dotted paths and JSONPath expressions", func() {
+		oauthTokenConfig.Spec.TokenResponse.AccessTokenFieldName = "result.accessToken"
+		oauthTokenConfig.Spec.TokenResponse.RefreshTokenFieldName = "{.result.refresh.token}"
+		oauthTokenConfig.Spec.TokenResponse.ExpirationFieldName = "$.result.ttl"
+
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(`{"result": {"accessToken": "nested-token", "refresh": {"token": "nested-refresh"}, "ttl": 3600}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.AccessToken).To(Equal("nested-token"))
+		Expect(tokens.RefreshToken).To(Equal("nested-refresh"))
+		Expect(tokens.ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+	})
+
+	It("should prefer a top-level key containing dots", func() {
+		oauthTokenConfig.Spec.TokenResponse.AccessTokenFieldName = "token.value"
+
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(`{"token.value": "flat-token", "token": {"value": "nested-token"}, "expires_in": 60}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.AccessToken).To(Equal("flat-token"))
+	})
+
+	It("should coerce numeric strings for expiration fields", func() {
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(`{"access_token": "token", "expires_in": "3600", "refresh_expires_in": "7200"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+		Expect(tokens.RefreshExpiresAt).To(BeTemporally("~", time.Now().Add(2*time.Hour), time.Second))
+	})
+
+	It("should treat null optional fields as missing", func() {
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(`{"access_token": "token", "expires_in": 60, "refresh_token": null}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.RefreshToken).To(BeEmpty())
+	})
+
+	It("should fail for missing required fields and values which cannot be coerced", func() {
+		oauthTokenConfig.Spec.TokenResponse.AccessTokenFieldName = "result.accessToken"
+		_, err := ParseTokenResponse(oauthTokenConfig, []byte(`{"result": {}, "expires_in": 60}`))
+		Expect(err).To(MatchError(ContainSubstring("required field 'result.accessToken' not found")))
+
+		_, err = ParseTokenResponse(oauthTokenConfig, []byte(`{"result": {"accessToken": "token"}, "expires_in": "soon"}`))
+		Expect(err).To(MatchError(ContainSubstring("field 'expires_in' is not a number")))
+	})
+
+	It("should read absolute expiration times in the configured format", func() {
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		oauthTokenConfig.Spec.TokenResponse.ExpirationFieldName = "expires_at"
+
+		oauthTokenConfig.Spec.TokenResponse.ExpirationFormat = "epoch"
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(fmt.Sprintf(`{"access_token": "token", "expires_at": %d}`, expiresAt.Unix())))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.ExpiresAt).To(BeTemporally("==", expiresAt))
+
+		oauthTokenConfig.Spec.TokenResponse.ExpirationFormat = "epochMillis"
+		tokens, err = ParseTokenResponse(oauthTokenConfig, []byte(fmt.Sprintf(`{"access_token": "token", "expires_at": "%d"}`, expiresAt.UnixMilli())))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.ExpiresAt).To(BeTemporally("==", expiresAt))
+
+		oauthTokenConfig.Spec.TokenResponse.ExpirationFormat = "rfc3339"
+		tokens, err = ParseTokenResponse(oauthTokenConfig, []byte(fmt.Sprintf(`{"access_token": "token", "expires_at": "%s"}`, expiresAt.Format(time.RFC3339))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.ExpiresAt).To(BeTemporally("==", expiresAt))
+	})
+
+	It("should fall back to the exp claim of JWT tokens and allow tokens without expiration", func() {
+		exp := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub": "user", "exp": %d}`, exp.Unix())))
+		jwt := "eyJhbGciOiJub25lIn0." + payload + ".signature"
+
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(fmt.Sprintf(`{"access_token": "%s", "refresh_token": "%s"}`, jwt, jwt)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.ExpiresAt).To(BeTemporally("==", exp))
+		Expect(tokens.RefreshExpiresAt).To(BeTemporally("==", exp))
+
+		tokens, err = ParseTokenResponse(oauthTokenConfig, []byte(`{"access_token": "opaque-token"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.ExpiresAt.IsZero()).To(BeTrue())
+	})
+
+	It("should read additional fields and allow missing optional ones", func() {
+		oauthTokenConfig.Spec.Target.AdditionalFields = []authv1alpha1.AdditionalField{
+			{Path: "id_token", Key: "id_token", Required: true},
+			{Path: "instance.url", Key: "instance_url"},
+			{Path: "{.claims}", Key: "claims"},
+			{Path: "token_type", Key: "token_type"},
+		}
+
+		tokens, err := ParseTokenResponse(oauthTokenConfig, []byte(`{"access_token": "token", "id_token": "id", "instance": {"url": "https://example.my.salesforce.com"}, "claims": {"roles": ["admin"]}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.AdditionalFields).To(Equal(map[string]string{
+			"id_token":     "id",
+			"instance_url": "https://example.my.salesforce.com",
+			"claims":       `{"roles":["admin"]}`,
+		}))
+
+		_, err = ParseTokenResponse(oauthTokenConfig, []byte(`{"access_token": "token"}`))
+		Expect(err).To(MatchError(ContainSubstring("required field 'id_token' not found")))
+	})
+})
+
+var _ = Describe("Retry-After header", func() {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	response := func(statusCode int, value string) *http.Response {
+		return &http.Response{StatusCode: statusCode, Header: http.Header{"Retry-After": []string{value}}}
+	}
+
+	It("should read seconds and HTTP dates of 429 and 503 responses", func() {
+		Expect(retryAfter(response(http.StatusTooManyRequests, "120"), now)).To(Equal(2 * time.Minute))
+		Expect(retryAfter(response(http.StatusServiceUnavailable, now.Add(time.Minute).Format(http.TimeFormat)), now)).To(Equal(time.Minute))
+	})
+
+	It("should ignore other responses and invalid values", func() {
+		Expect(retryAfter(response(http.StatusBadRequest, "120"), now)).To(BeZero())
+		Expect(retryAfter(response(http.StatusTooManyRequests, "soon"), now)).To(BeZero())
+		Expect(retryAfter(response(http.StatusServiceUnavailable, now.Add(-time.Minute).Format(http.TimeFormat)), now)).To(BeZero())
+	})
+})
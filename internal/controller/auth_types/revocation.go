@@ -0,0 +1,79 @@
+package authtypes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Token type hints of the revocation request (RFC 7009 section 2.1)
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// Function to revoke a token at the revocation endpoint (RFC 7009), the server also answers unknown or already
+// revoked tokens with 200, so only an unreachable server or a rejected client is an error
+func RevokeToken(ctx context.Context, grantRequest GrantRequest, token string, tokenTypeHint string) error {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	log := log.FromContext(ctx)
+	revocationURL := grantRequest.Endpoints.Revocation
+	if revocationURL == "" {
+		return fmt.Errorf("no revocation endpoint configured")
+	}
+	log.V(1).Info("Revoking token", "revocationURL", revocationURL, "tokenTypeHint", tokenTypeHint)
+
+	// The client authenticates like at the token endpoint, a client assertion keeps the token endpoint as audience
+	data := url.Values{}
+	data.Set("token", token)
+	data.Set("token_type_hint", tokenTypeHint)
+	authorization, err := ApplyClientAuthentication(ctx, grantRequest, grantRequest.TokenURL(), data)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate client: %w", err)
+	}
+
+	// Revocation requests are always form encoded POST requests, independent of the token request configuration
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revocationURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentTypeForm)
+	req.Header.Set("Accept", ContentTypeJSON)
+	for key, value := range oauthTokenConfig.Spec.TokenRequest.Headers {
+		req.Header.Set(key, value)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := grantRequest.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Error(closeErr, "Failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	responseBody, _ := io.ReadAll(resp.Body)
+	errorResponse := newErrorResponse(resp.StatusCode, responseBody)
+	errorResponse.RetryAfter = retryAfter(resp, time.Now())
+
+	// Servers which cannot revoke a type of token, commonly self-contained access tokens, say so (RFC 7009 section 2.2.1),
+	// retrying cannot change that and the token expires on its own
+	if errorResponse.Code == "unsupported_token_type" {
+		log.Info("Token type cannot be revoked", "tokenTypeHint", tokenTypeHint)
+		return nil
+	}
+	return errorResponse
+}
@@ -0,0 +1,94 @@
+package authtypes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+)
+
+var _ = Describe("Token revocation", func() {
+	var (
+		ctx          context.Context
+		server       *httptest.Server
+		requests     []url.Values
+		status       int
+		responseBody string
+		grantRequest GrantRequest
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		requests = nil
+		status = http.StatusOK
+		responseBody = ""
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal(ContentTypeForm))
+			Expect(r.ParseForm()).To(Succeed())
+			requests = append(requests, r.PostForm)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(responseBody))
+		}))
+
+		grantRequest = GrantRequest{
+			HTTPClient: server.Client(),
+			OAuthTokenConfig: authv1alpha1.OAuthTokenConfig{
+				Spec: authv1alpha1.OAuthTokenConfigSpec{
+					TokenURL:    server.URL + "/token",
+					Credentials: authv1alpha1.CredentialsConfig{ClientIDFieldName: "client_id", ClientSecretFieldName: "client_secret"},
+					TokenRequest: authv1alpha1.TokenRequestConfig{
+						// A GET token request must not change the revocation request
+						Method:                http.MethodGet,
+						ClientIDFieldName:     "client_id",
+						ClientSecretFieldName: "client_secret",
+					},
+				},
+			},
+			CredentialsSecret: corev1.Secret{Data: map[string][]byte{
+				"client_id":     []byte("test-client"),
+				"client_secret": []byte("test-secret"),
+			}},
+			Endpoints: Endpoints{Token: server.URL + "/token", Revocation: server.URL + "/revoke"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should post the token with its type hint and the client credentials", func() {
+		Expect(RevokeToken(ctx, grantRequest, "refresh-token", TokenTypeHintRefreshToken)).To(Succeed())
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Get("token")).To(Equal("refresh-token"))
+		Expect(requests[0].Get("token_type_hint")).To(Equal("refresh_token"))
+		Expect(requests[0].Get("client_id")).To(Equal("test-client"))
+		Expect(requests[0].Get("client_secret")).To(Equal("test-secret"))
+	})
+
+	It("should accept servers which cannot revoke the token type", func() {
+		status = http.StatusBadRequest
+		responseBody = `{"error":"unsupported_token_type"}`
+		Expect(RevokeToken(ctx, grantRequest, "access-token", TokenTypeHintAccessToken)).To(Succeed())
+	})
+
+	It("should fail if the server is unavailable", func() {
+		status = http.StatusServiceUnavailable
+		err := RevokeToken(ctx, grantRequest, "refresh-token", TokenTypeHintRefreshToken)
+		var errorResponse *ErrorResponse
+		Expect(err).To(BeAssignableToTypeOf(errorResponse))
+	})
+
+	It("should fail without a revocation endpoint", func() {
+		grantRequest.Endpoints.Revocation = ""
+		Expect(RevokeToken(ctx, grantRequest, "refresh-token", TokenTypeHintRefreshToken)).NotTo(Succeed())
+		Expect(requests).To(BeEmpty())
+	})
+})
@@ -0,0 +1,48 @@
+package authtypes
+
+import (
+	"context"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Default lifetime of a requested service account token, the minimum accepted by the TokenRequest API
+const defaultServiceAccountTokenExpirationSeconds int64 = 600
+
+// Function to request a bound service account token through the TokenRequest API,
+// the service account has to be in the namespace of the OAuthTokenConfig
+func ServiceAccountToken(ctx context.Context, grantRequest GrantRequest) (string, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	serviceAccountToken := oauthTokenConfig.Spec.ServiceAccountToken
+	if serviceAccountToken == nil {
+		return "", fmt.Errorf("serviceAccountToken is required")
+	}
+
+	expirationSeconds := defaultServiceAccountTokenExpirationSeconds
+	if serviceAccountToken.ExpirationSeconds != nil {
+		expirationSeconds = *serviceAccountToken.ExpirationSeconds
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceAccountToken.ServiceAccountName,
+			Namespace: oauthTokenConfig.Namespace,
+		},
+	}
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{serviceAccountToken.Audience},
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	if err := grantRequest.KubeClient.SubResource("token").Create(ctx, serviceAccount, tokenRequest); err != nil {
+		return "", fmt.Errorf("failed to request token for service account %s/%s: %w", serviceAccount.Namespace, serviceAccount.Name, err)
+	}
+	if tokenRequest.Status.Token == "" {
+		return "", fmt.Errorf("empty token returned for service account %s/%s", serviceAccount.Namespace, serviceAccount.Name)
+	}
+	return tokenRequest.Status.Token, nil
+}
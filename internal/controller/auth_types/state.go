@@ -0,0 +1,51 @@
+package authtypes
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// GrantState keeps the state of grants spanning several reconciliations per OAuthTokenConfig, e.g. a pending device
+// authorization. It is owned by the reconciler, which drops the state of a resource when it is deleted
+type GrantState struct {
+	mutex   sync.Mutex
+	entries map[types.NamespacedName]any
+
+	// Optional: clock of the grant handlers, defaults to time.Now
+	Now func() time.Time
+}
+
+// Function to get the current time of the grant handlers
+func (s *GrantState) Clock() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Function to get the state of an OAuthTokenConfig
+func (s *GrantState) Load(name types.NamespacedName) (any, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, ok := s.entries[name]
+	return value, ok
+}
+
+// Function to store the state of an OAuthTokenConfig
+func (s *GrantState) Store(name types.NamespacedName, value any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.entries == nil {
+		s.entries = map[types.NamespacedName]any{}
+	}
+	s.entries[name] = value
+}
+
+// Function to drop the state of an OAuthTokenConfig
+func (s *GrantState) Forget(name types.NamespacedName) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, name)
+}
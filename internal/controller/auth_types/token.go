@@ -0,0 +1,335 @@
+package authtypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ErrorResponse is returned for non-200 responses of the authorization server
+type ErrorResponse struct {
+	StatusCode int
+
+	// Error code and description of an OAuth2 error response (RFC 6749 section 5.2), empty if the body is no such response
+	Code        string
+	Description string
+
+	Body string
+
+	// Delay requested by the server with a Retry-After header on 429 and 503 responses, zero without one
+	RetryAfter time.Duration
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("non-200 response: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// ResponseParseError is returned if the token response cannot be read with the configured field names and formats
+type ResponseParseError struct {
+	Err error
+}
+
+func (e *ResponseParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ResponseParseError) Unwrap() error {
+	return e.Err
+}
+
+// Function to check if the server rejected the grant itself, e.g. an expired or revoked refresh token,
+// as opposed to a temporary failure which is worth retrying with the same grant
+func (e *ErrorResponse) Rejected() bool {
+	if e.Code != "" {
+		return e.Code == "invalid_grant"
+	}
+	return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnauthorized
+}
+
+// Function to get token
+func GetToken(ctx context.Context, grantRequest GrantRequest, data url.Values) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	log := log.FromContext(ctx)
+	tokenURL := grantRequest.TokenURL()
+	log.V(1).Info("Getting token", "tokenURL", tokenURL, "grantType", data.Get(oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName))
+
+	if err := ApplyTokenParameters(ctx, grantRequest, data); err != nil {
+		return nil, err
+	}
+	responseBody, err := SendRequest(ctx, grantRequest, tokenURL, data)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := ParseTokenResponse(oauthTokenConfig, responseBody)
+	if err != nil {
+		return nil, &ResponseParseError{Err: err}
+	}
+
+	// An omitted scope is identical to the requested one (RFC 6749 section 5.1)
+	if tokens.Scope == "" {
+		tokens.Scope = data.Get("scope")
+	}
+	return tokens, nil
+}
+
+// Function to send an authenticated request to an endpoint of the authorization server and read the response body
+func SendRequest(ctx context.Context, grantRequest GrantRequest, endpointURL string, data url.Values) ([]byte, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	log := log.FromContext(ctx)
+
+	// A held back request is neither authenticated nor sent
+	if grantRequest.Admit != nil {
+		if err := grantRequest.Admit(endpointURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Authenticate the client
+	authorization, err := ApplyClientAuthentication(ctx, grantRequest, endpointURL, data)
+	if err != nil {
+		log.Error(err, "Failed to authenticate client", "method", ClientAuthenticationMethod(oauthTokenConfig))
+		return nil, fmt.Errorf("failed to authenticate client: %w", err)
+	}
+
+	// Build Request
+	req, err := BuildTokenRequest(ctx, oauthTokenConfig, endpointURL, data)
+	if err != nil {
+		log.Error(err, "Failed to create HTTP request", "url", endpointURL)
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	// Send Request
+	resp, err := grantRequest.HTTPClient.Do(req)
+	if err != nil {
+		log.Error(err, "Failed to make HTTP request", "url", endpointURL)
+		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Error(closeErr, "Failed to close response body")
+		}
+	}()
+
+	// Process Response
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		log.Info("Non-200 response received", "statusCode", resp.StatusCode, "body", string(responseBody))
+		errorResponse := newErrorResponse(resp.StatusCode, responseBody)
+		errorResponse.RetryAfter = retryAfter(resp, time.Now())
+		return nil, errorResponse
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err, "Failed to read response body")
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return responseBody, nil
+}
+
+// Function to build an ErrorResponse, the OAuth2 error code is extracted if the body is a JSON error response
+func newErrorResponse(statusCode int, responseBody []byte) *ErrorResponse {
+	errorResponse := &ErrorResponse{StatusCode: statusCode, Body: string(responseBody)}
+	var body struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(responseBody, &body); err == nil {
+		errorResponse.Code = body.Error
+		errorResponse.Description = body.ErrorDescription
+	}
+	return errorResponse
+}
+
+// Function to read the Retry-After header of a 429 or 503 response, in seconds or as HTTP date (RFC 9110 section 10.2.3)
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// Function to parse token response
+func ParseTokenResponse(oauthTokenConfig authv1alpha1.OAuthTokenConfig, responseBody []byte) (*definitions.Tokens, error) {
+	// Parse the response body into a generic map
+	var response map[string]interface{}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Create a Tokens struct to hold the parsed values
+	tokens := &definitions.Tokens{}
+	stringFieldMapping := map[string]*string{
+		oauthTokenConfig.Spec.TokenResponse.AccessTokenFieldName:  &tokens.AccessToken,
+		oauthTokenConfig.Spec.TokenResponse.RefreshTokenFieldName: &tokens.RefreshToken,
+	}
+
+	// Fields which are allowed to be missing, e.g. client_credentials responses usually carry no refresh token
+	optionalFields := map[string]bool{
+		oauthTokenConfig.Spec.TokenResponse.RefreshTokenFieldName: true,
+	}
+
+	// Map string fields, the field names may be paths into nested objects
+	for fieldName, target := range stringFieldMapping {
+		value, ok, err := ResponseField(response, fieldName)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if !optionalFields[fieldName] {
+				return nil, fmt.Errorf("required field '%s' not found in response", fieldName)
+			}
+			continue
+		}
+		if *target, err = StringValue(value); err != nil {
+			return nil, fmt.Errorf("field '%s' is not a string: %w", fieldName, err)
+		}
+	}
+
+	// Map expiration fields, without them the exp claim of JWT tokens is used and else the token does not expire
+	now := time.Now()
+	var err error
+	if tokens.ExpiresAt, err = expiration(oauthTokenConfig, response, oauthTokenConfig.Spec.TokenResponse.ExpirationFieldName, tokens.AccessToken, now); err != nil {
+		return nil, err
+	}
+	if tokens.RefreshExpiresAt, err = expiration(oauthTokenConfig, response, oauthTokenConfig.Spec.TokenResponse.RefreshExpirationFieldName, tokens.RefreshToken, now); err != nil {
+		return nil, err
+	}
+
+	// Map additional fields, objects and lists are stored as JSON
+	for _, field := range oauthTokenConfig.Spec.Target.AdditionalFields {
+		value, ok, err := ResponseField(response, field.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if field.Required {
+				return nil, fmt.Errorf("required field '%s' not found in response", field.Path)
+			}
+			continue
+		}
+		if tokens.AdditionalFields == nil {
+			tokens.AdditionalFields = map[string]string{}
+		}
+		if tokens.AdditionalFields[field.Key], err = additionalFieldValue(value); err != nil {
+			return nil, fmt.Errorf("failed to read field '%s': %w", field.Path, err)
+		}
+	}
+
+	// The granted scope is informational, some servers return it as a list instead of a space separated string
+	switch scope := response["scope"].(type) {
+	case string:
+		tokens.Scope = scope
+	case []interface{}:
+		scopes := make([]string, 0, len(scope))
+		for _, value := range scope {
+			scopes = append(scopes, fmt.Sprint(value))
+		}
+		tokens.Scope = strings.Join(scopes, " ")
+	}
+
+	return tokens, nil
+}
+
+// Function to convert the value of an additional field into the content of a secret key
+func additionalFieldValue(value interface{}) (string, error) {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	default:
+		return StringValue(value)
+	}
+}
+
+// Function to read an expiration field in the configured format, falls back to the exp claim of the token
+func expiration(oauthTokenConfig authv1alpha1.OAuthTokenConfig, response map[string]interface{}, fieldName string, token string, now time.Time) (time.Time, error) {
+	value, ok, err := ResponseField(response, fieldName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return JWTExpiration(token), nil
+	}
+
+	switch format := oauthTokenConfig.Spec.TokenResponse.ExpirationFormat; format {
+	case "", definitions.EXPIRATION_FORMAT_RELATIVE, definitions.EXPIRATION_FORMAT_EPOCH, definitions.EXPIRATION_FORMAT_EPOCH_MILLIS:
+		number, err := IntValue(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("field '%s' is not a number: %w", fieldName, err)
+		}
+		switch format {
+		case definitions.EXPIRATION_FORMAT_EPOCH:
+			return time.Unix(int64(number), 0), nil
+		case definitions.EXPIRATION_FORMAT_EPOCH_MILLIS:
+			return time.UnixMilli(int64(number)), nil
+		default:
+			return now.Add(time.Duration(number) * time.Second), nil
+		}
+	case definitions.EXPIRATION_FORMAT_RFC3339:
+		timestamp, err := StringValue(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("field '%s' is not a string: %w", fieldName, err)
+		}
+		expiresAt, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("field '%s' is not an RFC3339 timestamp: %w", fieldName, err)
+		}
+		return expiresAt, nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported expiration format %s", format)
+	}
+}
+
+// Function to refresh a token using the refresh_token grant, shared by all grant types issuing refresh tokens
+func RefreshWithToken(ctx context.Context, grantRequest GrantRequest, refreshToken string) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+
+	data := url.Values{}
+	data.Set(oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName, "refresh_token")
+	data.Set(oauthTokenConfig.Spec.TokenRequest.RefreshTokenFieldName, refreshToken)
+
+	tokens, err := GetToken(ctx, grantRequest, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers without refresh token rotation return no new refresh token, the current one stays valid (RFC 6749 section 6)
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+		if tokens.RefreshExpiresAt.IsZero() {
+			tokens.RefreshExpiresAt = JWTExpiration(refreshToken)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,172 @@
+package tokenexchange
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// GrantType is the name under which the token exchange grant is registered
+const GrantType = "token-exchange"
+
+// Grant type URN and default subject token type defined in RFC 8693
+const (
+	grantTypeURN            = "urn:ietf:params:oauth:grant-type:token-exchange"
+	defaultSubjectTokenType = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+func init() {
+	authtypes.Register(GrantType, Handler{})
+}
+
+// Handler implements the token exchange grant (RFC 8693)
+type Handler struct{}
+
+// Function to get the grant_type value of the token exchange grant
+func (Handler) AdvertisedGrantType() string {
+	return grantTypeURN
+}
+
+// Function to list the credentials required by the token exchange grant
+func (Handler) RequiredCredentialFields(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	return authtypes.ClientAuthenticationFields(oauthTokenConfig)
+}
+
+// Function to validate the token exchange specific configuration
+func (Handler) Validate(oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	tokenExchange := oauthTokenConfig.Spec.TokenExchange
+	if tokenExchange == nil {
+		return fmt.Errorf("tokenExchange is required")
+	}
+
+	// Guard against exchanging the own token, which would re-exchange on every refresh
+	if ref := tokenExchange.SubjectToken.OAuthTokenConfigRef; ref != nil {
+		if ref.Name == oauthTokenConfig.Name && namespaceOrDefault(ref.Namespace, oauthTokenConfig) == oauthTokenConfig.Namespace {
+			return fmt.Errorf("tokenExchange.subjectToken must not reference the OAuthTokenConfig itself")
+		}
+	}
+
+	// The token of the controller itself is never sent, a bound token of a service account of the resource is requested
+	if tokenExchange.SubjectToken.ServiceAccountToken && oauthTokenConfig.Spec.ServiceAccountToken == nil {
+		return fmt.Errorf("tokenExchange.subjectToken.serviceAccountToken requires the serviceAccountToken section")
+	}
+	return nil
+}
+
+// Function to exchange the subject token for a new token
+func (h Handler) Acquire(ctx context.Context, grantRequest authtypes.GrantRequest) (*definitions.Tokens, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	tokenExchange := oauthTokenConfig.Spec.TokenExchange
+
+	// A service account token is requested for every exchange, other subject tokens are read from their secret
+	var subjectToken string
+	var err error
+	if tokenExchange.SubjectToken.ServiceAccountToken {
+		subjectToken, err = authtypes.ServiceAccountToken(ctx, grantRequest)
+	} else {
+		subjectToken, err = h.SubjectToken(ctx, grantRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	subjectTokenType := tokenExchange.SubjectTokenType
+	if subjectTokenType == "" {
+		subjectTokenType = defaultSubjectTokenType
+	}
+
+	data := url.Values{}
+	data.Set(oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName, grantTypeURN)
+	data.Set("subject_token", subjectToken)
+	data.Set("subject_token_type", subjectTokenType)
+	if tokenExchange.RequestedTokenType != "" {
+		data.Set("requested_token_type", tokenExchange.RequestedTokenType)
+	}
+	for _, audience := range tokenExchange.Audience {
+		data.Add("audience", audience)
+	}
+	for _, resource := range tokenExchange.Resource {
+		data.Add("resource", resource)
+	}
+	if tokenExchange.Scope != "" {
+		data.Set("scope", tokenExchange.Scope)
+	}
+
+	return authtypes.GetToken(ctx, grantRequest, data)
+}
+
+// Function to refresh the token, the subject token is exchanged again since it is the source of truth
+func (h Handler) Refresh(ctx context.Context, grantRequest authtypes.GrantRequest, refreshToken string) (*definitions.Tokens, error) {
+	return h.Acquire(ctx, grantRequest)
+}
+
+// Function to read the current subject token from the configured source. Empty for a service account token,
+// which is requested for every exchange and therefore not tracked
+func (h Handler) SubjectToken(ctx context.Context, grantRequest authtypes.GrantRequest) (string, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	if oauthTokenConfig.Spec.TokenExchange == nil {
+		return "", fmt.Errorf("tokenExchange is required")
+	}
+	if oauthTokenConfig.Spec.TokenExchange.SubjectToken.ServiceAccountToken {
+		return "", nil
+	}
+
+	secretName, key, err := h.subjectSecretKey(ctx, grantRequest)
+	if err != nil {
+		return "", err
+	}
+	secret := &corev1.Secret{}
+	if err := grantRequest.KubeClient.Get(ctx, secretName, secret); err != nil {
+		return "", fmt.Errorf("failed to fetch subject token secret %s: %w", secretName, err)
+	}
+	token, ok := secret.Data[key]
+	if !ok || len(token) == 0 {
+		return "", fmt.Errorf("subject token secret %s has no field %s", secretName, key)
+	}
+	return string(token), nil
+}
+
+// Function to resolve the secret and key holding the subject token
+func (Handler) subjectSecretKey(ctx context.Context, grantRequest authtypes.GrantRequest) (types.NamespacedName, string, error) {
+	oauthTokenConfig := grantRequest.OAuthTokenConfig
+	source := oauthTokenConfig.Spec.TokenExchange.SubjectToken
+
+	switch {
+	case source.SecretKeyRef != nil:
+		secretName := types.NamespacedName{
+			Name:      source.SecretKeyRef.Name,
+			Namespace: namespaceOrDefault(source.SecretKeyRef.Namespace, oauthTokenConfig),
+		}
+		return secretName, source.SecretKeyRef.Key, nil
+	case source.OAuthTokenConfigRef != nil:
+		// The subject token is the access token in the target secret of the referenced OAuthTokenConfig
+		subjectConfigName := types.NamespacedName{
+			Name:      source.OAuthTokenConfigRef.Name,
+			Namespace: namespaceOrDefault(source.OAuthTokenConfigRef.Namespace, oauthTokenConfig),
+		}
+		subjectConfig := &authv1alpha1.OAuthTokenConfig{}
+		if err := grantRequest.KubeClient.Get(ctx, subjectConfigName, subjectConfig); err != nil {
+			return types.NamespacedName{}, "", fmt.Errorf("failed to fetch subject OAuthTokenConfig %s: %w", subjectConfigName, err)
+		}
+		secretName := types.NamespacedName{
+			Name:      subjectConfig.Spec.Target.SecretRef.Name,
+			Namespace: subjectConfig.Spec.Target.SecretRef.Namespace,
+		}
+		return secretName, subjectConfig.Spec.Target.AccessTokenFieldName, nil
+	default:
+		return types.NamespacedName{}, "", fmt.Errorf("tokenExchange.subjectToken has no source")
+	}
+}
+
+// Function to default an empty namespace to the namespace of the OAuthTokenConfig
+func namespaceOrDefault(namespace string, oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	if namespace == "" {
+		return oauthTokenConfig.Namespace
+	}
+	return namespace
+}
@@ -0,0 +1,95 @@
+package authtypes_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	"github.com/winklermichael/otto/internal/controller/auth_types/tokenexchange"
+)
+
+var _ = Describe("Token exchange", func() {
+	var (
+		mockServer       *httptest.Server
+		receivedForm     url.Values
+		oauthTokenConfig authv1alpha1.OAuthTokenConfig
+	)
+
+	BeforeEach(func() {
+		mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bodyBytes, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			receivedForm, err = url.ParseQuery(string(bodyBytes))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = w.Write([]byte(`{"access_token": "exchanged-token", "expires_in": 360}`))
+			Expect(err).NotTo(HaveOccurred())
+		}))
+
+		oauthTokenConfig = authv1alpha1.OAuthTokenConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "exchange", Namespace: "default"},
+			Spec: authv1alpha1.OAuthTokenConfigSpec{
+				TokenURL: mockServer.URL + "/oauth/token",
+				Type:     tokenexchange.GrantType,
+				TokenRequest: authv1alpha1.TokenRequestConfig{
+					Method:             "POST",
+					ContentType:        authtypes.ContentTypeForm,
+					GrantTypeFieldName: "grant_type",
+				},
+				TokenResponse: authv1alpha1.TokenResponseConfig{
+					AccessTokenFieldName: "access_token",
+					ExpirationFieldName:  "expires_in",
+				},
+				ClientAuthentication: &authv1alpha1.ClientAuthenticationConfig{Method: authtypes.ClientAuthenticationNone, ClientID: "exchange-client"},
+				TokenExchange: &authv1alpha1.TokenExchangeConfig{
+					SubjectToken: authv1alpha1.TokenSource{ServiceAccountToken: true},
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		mockServer.Close()
+	})
+
+	It("should require the serviceAccountToken section for a service account subject token", func() {
+		handler := tokenexchange.Handler{}
+		Expect(handler.Validate(oauthTokenConfig)).To(MatchError(ContainSubstring("requires the serviceAccountToken section")))
+	})
+
+	It("should exchange a bound token of the configured service account", func() {
+		oauthTokenConfig.Spec.ServiceAccountToken = &authv1alpha1.ServiceAccountTokenConfig{
+			ServiceAccountName: "workload",
+			Audience:           "https://idp.example.com",
+		}
+		handler := tokenexchange.Handler{}
+		Expect(handler.Validate(oauthTokenConfig)).To(Succeed())
+
+		grantRequest := authtypes.GrantRequest{
+			HTTPClient: mockServer.Client(),
+			KubeClient: fake.NewClientBuilder().WithObjects(&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "default"},
+			}).Build(),
+			OAuthTokenConfig: oauthTokenConfig,
+		}
+		tokens, err := handler.Acquire(context.Background(), grantRequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens.AccessToken).To(Equal("exchanged-token"))
+		Expect(receivedForm.Get("subject_token")).To(Equal("fake-token"))
+
+		// The requested token is not tracked as subject token, it changes with every exchange
+		subjectToken, err := handler.SubjectToken(context.Background(), grantRequest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(subjectToken).To(BeEmpty())
+	})
+})
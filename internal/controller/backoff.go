@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// retryDelays holds the delay until the next retry of each failed OAuthTokenConfig, read once by the rate limiter
+type retryDelays struct {
+	mutex   sync.Mutex
+	entries map[types.NamespacedName]time.Duration
+}
+
+// function to calculate the delay before the next retry of a failed OAuthTokenConfig, the delay grows with the
+// consecutive failures up to the maximum and varies by the jitter. A Retry-After of the server is a lower bound
+func retryDelay(oauthTokenConfig authv1alpha1.OAuthTokenConfig, err error) time.Duration {
+	initial := REQUEUE_TIME
+	maximum := BACKOFF_MAX_TIME
+	multiplier := 2.0
+	jitterPercentage := int32(20)
+	if backoff := oauthTokenConfig.Spec.Backoff; backoff != nil {
+		if backoff.Initial != nil && backoff.Initial.Duration > 0 {
+			initial = backoff.Initial.Duration
+		}
+		if backoff.Max != nil && backoff.Max.Duration > 0 {
+			maximum = backoff.Max.Duration
+		}
+		if value, parseErr := strconv.ParseFloat(backoff.Multiplier, 64); parseErr == nil && value >= 1 {
+			multiplier = value
+		}
+		jitterPercentage = backoff.JitterPercentage
+	}
+
+	attempt := max(oauthTokenConfig.Status.ConsecutiveFailures, 1)
+	delay := min(float64(initial)*math.Pow(multiplier, float64(attempt-1)), float64(maximum))
+
+	// The jitter is applied to the capped delay so retries at the maximum still spread, but never exceed it
+	if jitterPercentage > 0 {
+		jitter := float64(jitterPercentage) / 100
+		delay = min(delay*(1+jitter*(2*rand.Float64()-1)), float64(maximum))
+	}
+	result := time.Duration(delay)
+
+	var errorResponse *authtypes.ErrorResponse
+	if errors.As(err, &errorResponse) && errorResponse.RetryAfter > result {
+		result = errorResponse.RetryAfter
+	}
+	return result
+}
+
+// function to count a failed reconciliation and schedule the next retry with the backoff policy of the resource
+func scheduleRetry(oauthTokenConfig *authv1alpha1.OAuthTokenConfig, err error) {
+	oauthTokenConfig.Status.ConsecutiveFailures++
+	oauthTokenConfig.Status.NextRetry = metav1.NewTime(time.Now().Add(retryDelay(*oauthTokenConfig, err)))
+}
+
+// function to end a failed reconciliation, the error is returned for the metrics and the rate limiter requeues the
+// resource at its next retry
+func (r *OAuthTokenConfigReconciler) retryResult(oauthTokenConfig authv1alpha1.OAuthTokenConfig, err error) (ctrl.Result, error) {
+	r.retries.mutex.Lock()
+	defer r.retries.mutex.Unlock()
+	if r.retries.entries == nil {
+		r.retries.entries = map[types.NamespacedName]time.Duration{}
+	}
+	r.retries.entries[types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}] = max(time.Until(oauthTokenConfig.Status.NextRetry.Time), 0)
+	return ctrl.Result{}, err
+}
+
+// function to take the delay of the next retry of a resource, false if none was scheduled
+func (r *OAuthTokenConfigReconciler) takeRetryDelay(name types.NamespacedName) (time.Duration, bool) {
+	r.retries.mutex.Lock()
+	defer r.retries.mutex.Unlock()
+	delay, ok := r.retries.entries[name]
+	delete(r.retries.entries, name)
+	return delay, ok
+}
+
+// backoffRateLimiter requeues failed OAuthTokenConfigs at the next retry of their backoff policy, errors without
+// a scheduled retry, e.g. a failed status update, fall back to the default rate limiter of controller-runtime
+type backoffRateLimiter struct {
+	reconciler *OAuthTokenConfigReconciler
+	fallback   workqueue.TypedRateLimiter[reconcile.Request]
+}
+
+func newBackoffRateLimiter(reconciler *OAuthTokenConfigReconciler) *backoffRateLimiter {
+	return &backoffRateLimiter{
+		reconciler: reconciler,
+		fallback:   workqueue.DefaultTypedControllerRateLimiter[reconcile.Request](),
+	}
+}
+
+func (l *backoffRateLimiter) When(request reconcile.Request) time.Duration {
+	if delay, ok := l.reconciler.takeRetryDelay(request.NamespacedName); ok {
+		return delay
+	}
+	return l.fallback.When(request)
+}
+
+func (l *backoffRateLimiter) Forget(request reconcile.Request) {
+	l.fallback.Forget(request)
+}
+
+func (l *backoffRateLimiter) NumRequeues(request reconcile.Request) int {
+	return l.fallback.NumRequeues(request)
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// function to set a condition for the current generation of an OAuthTokenConfig, returns true if it changed
+func setCondition(oauthTokenConfig *authv1alpha1.OAuthTokenConfig, conditionType string, status metav1.ConditionStatus, reason string, message string) bool {
+	return meta.SetStatusCondition(&oauthTokenConfig.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: oauthTokenConfig.Generation,
+	})
+}
+
+// function to record a failed reconciliation in the condition of the failed step and schedule the next retry
+func recordFailure(oauthTokenConfig *authv1alpha1.OAuthTokenConfig, conditionType string, reason string, err error) {
+	scheduleRetry(oauthTokenConfig, err)
+	setCondition(oauthTokenConfig, conditionType, metav1.ConditionFalse, reason, err.Error())
+}
+
+// function to set the Ready condition from the other conditions, the first failed one gives the reason.
+// Conditions missing on resources reconciled by previous versions of the controller do not block it
+func setReadyCondition(oauthTokenConfig *authv1alpha1.OAuthTokenConfig) {
+	for _, conditionType := range []string{definitions.CONDITION_CREDENTIALS_VALID, definitions.CONDITION_TOKEN_ACQUIRED, definitions.CONDITION_TARGET_WRITTEN} {
+		condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, conditionType)
+		if condition != nil && condition.Status != metav1.ConditionTrue {
+			setCondition(oauthTokenConfig, definitions.CONDITION_READY, metav1.ConditionFalse, condition.Reason, condition.Message)
+			return
+		}
+	}
+	if oauthTokenConfig.Status.Status != definitions.STATUS_REFRESHED {
+		setCondition(oauthTokenConfig, definitions.CONDITION_READY, metav1.ConditionFalse, definitions.REASON_RECONCILING, "Waiting for the first token")
+		return
+	}
+	setCondition(oauthTokenConfig, definitions.CONDITION_READY, metav1.ConditionTrue, definitions.REASON_READY, "Token acquired and written to the targets")
+}
+
+// function to get the reason of a failed reading of a secret
+func secretFailureReason(err error) string {
+	if apierrors.IsNotFound(err) {
+		return definitions.REASON_SECRET_NOT_FOUND
+	}
+	return definitions.REASON_API_ERROR
+}
+
+// function to get the reason of a failed request to the authorization server, fallback for errors which are not
+// caused by the response of the server, e.g. an invalid private key
+func requestFailureReason(err error, fallback string) string {
+	var parseErr *authtypes.ResponseParseError
+	var errorResponse *authtypes.ErrorResponse
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &parseErr):
+		return definitions.REASON_RESPONSE_PARSE_ERROR
+	case errors.As(err, &errorResponse):
+		switch {
+		case errorResponse.Code == "invalid_client" || errorResponse.Code == "unauthorized_client":
+			return definitions.REASON_INVALID_CLIENT
+		case errorResponse.Code == "" && errorResponse.StatusCode == http.StatusUnauthorized:
+			return definitions.REASON_INVALID_CLIENT
+		case errorResponse.Rejected():
+			return definitions.REASON_INVALID_GRANT
+		case errorResponse.StatusCode == http.StatusTooManyRequests:
+			return definitions.REASON_RATE_LIMITED
+		case errorResponse.StatusCode >= http.StatusInternalServerError:
+			return definitions.REASON_ENDPOINT_UNREACHABLE
+		}
+		return definitions.REASON_TOKEN_REQUEST_FAILED
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return definitions.REASON_ENDPOINT_UNREACHABLE
+	case apierrors.IsNotFound(err):
+		return definitions.REASON_SECRET_NOT_FOUND
+	}
+	return fallback
+}
+
+// function to set the TargetWritten condition from the result of writing the targets, returns true if it changed
+func setTargetWrittenCondition(oauthTokenConfig *authv1alpha1.OAuthTokenConfig, err error) bool {
+	condition := metav1.Condition{
+		Type:               definitions.CONDITION_TARGET_WRITTEN,
+		Status:             metav1.ConditionTrue,
+		Reason:             definitions.REASON_APPLIED,
+		Message:            "Target secrets written",
+		ObservedGeneration: oauthTokenConfig.Generation,
+	}
+	var conflictErr *TargetConflictError
+	if errors.As(err, &conflictErr) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = definitions.REASON_CONFLICT
+		condition.Message = err.Error()
+	} else if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = definitions.REASON_WRITE_FAILED
+		condition.Message = err.Error()
+	}
+	return meta.SetStatusCondition(&oauthTokenConfig.Status.Conditions, condition)
+}
+
+// function to persist the TargetWritten condition, the status is only updated if the condition changed
+func (r *OAuthTokenConfigReconciler) updateTargetWrittenCondition(ctx context.Context, oauthTokenConfig *authv1alpha1.OAuthTokenConfig, err error) error {
+	if !setTargetWrittenCondition(oauthTokenConfig, err) {
+		return nil
+	}
+	return r.updateStatus(ctx, oauthTokenConfig)
+}
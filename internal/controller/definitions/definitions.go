@@ -1,15 +1,87 @@
 package controller
 
-// Tokens represents the structure of the OAuth2 token response
+import "time"
+
+// Tokens represents the structure of the OAuth2 token response, a zero expiration time means the token does not expire
 type Tokens struct {
 	AccessToken      string
 	RefreshToken     string
-	ExpiresIn        int
-	RefreshExpiresIn int
+	ExpiresAt        time.Time
+	RefreshExpiresAt time.Time
+	Scope            string
+
+	// Values of the additional fields by key of the target secret, missing optional fields are left out
+	AdditionalFields map[string]string
 }
 
 // Constants
 var (
 	STATUS_FAILED    = "FAILED"
 	STATUS_REFRESHED = "REFRESHED"
+	STATUS_PENDING   = "PENDING"
+
+	STATUS_REAUTHENTICATION_REQUIRED = "REAUTHENTICATION_REQUIRED"
+)
+
+// Deletion policies of the targets
+var (
+	DELETION_POLICY_DELETE           = "Delete"
+	DELETION_POLICY_ORPHAN           = "Orphan"
+	DELETION_POLICY_REMOVE_KEYS_ONLY = "RemoveKeysOnly"
+)
+
+// Finalizer, label and annotation of the resources managed by the controller
+var (
+	FINALIZER        = "auth.example.com/finalizer"
+	LABEL_MANAGED_BY = "app.kubernetes.io/managed-by"
+	MANAGED_BY       = "otto"
+	ANNOTATION_OWNER = "auth.example.com/owner"
+
+	// Set on the secrets and ConfigMaps the controller created, only those are deleted with the Delete policy
+	ANNOTATION_CREATED_BY = "auth.example.com/created-by"
+
+	// Set to "true" to delete an OAuthTokenConfig without revoking its tokens, e.g. while the authorization server is down
+	ANNOTATION_SKIP_REVOCATION = "auth.example.com/skip-revocation"
+)
+
+// Types and reasons of the status conditions
+var (
+	CONDITION_READY               = "Ready"
+	CONDITION_CREDENTIALS_VALID   = "CredentialsValid"
+	CONDITION_TOKEN_ACQUIRED      = "TokenAcquired"
+	CONDITION_TARGET_WRITTEN      = "TargetWritten"
+	CONDITION_REFRESH_TOKEN_VALID = "RefreshTokenValid"
+	CONDITION_THROTTLED           = "Throttled"
+
+	REASON_READY                     = "TokenReady"
+	REASON_RECONCILING               = "Reconciling"
+	REASON_VALID                     = "Valid"
+	REASON_ACQUIRED                  = "Acquired"
+	REASON_NOT_ISSUED                = "NotIssued"
+	REASON_APPLIED                   = "Applied"
+	REASON_CONFLICT                  = "Conflict"
+	REASON_WRITE_FAILED              = "WriteFailed"
+	REASON_SECRET_NOT_FOUND          = "SecretNotFound"
+	REASON_INVALID_SECRET            = "InvalidSecret"
+	REASON_INVALID_CONFIGURATION     = "InvalidConfiguration"
+	REASON_API_ERROR                 = "APIError"
+	REASON_INVALID_GRANT             = "InvalidGrant"
+	REASON_INVALID_CLIENT            = "InvalidClient"
+	REASON_ENDPOINT_UNREACHABLE      = "EndpointUnreachable"
+	REASON_RATE_LIMITED              = "RateLimited"
+	REASON_RESPONSE_PARSE_ERROR      = "ResponseParseError"
+	REASON_TOKEN_REQUEST_FAILED      = "TokenRequestFailed"
+	REASON_DISCOVERY_FAILED          = "DiscoveryFailed"
+	REASON_AUTHORIZATION_PENDING     = "AuthorizationPending"
+	REASON_REAUTHENTICATION_REQUIRED = "ReauthenticationRequired"
+	REASON_NOT_THROTTLED             = "NotThrottled"
+	REASON_CIRCUIT_OPEN              = "CircuitOpen"
+)
+
+// Formats of the expiration fields of the token response
+var (
+	EXPIRATION_FORMAT_RELATIVE     = "relative"
+	EXPIRATION_FORMAT_EPOCH        = "epoch"
+	EXPIRATION_FORMAT_EPOCH_MILLIS = "epochMillis"
+	EXPIRATION_FORMAT_RFC3339      = "rfc3339"
 )
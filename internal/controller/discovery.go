@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// discoveryCache holds the authorization server metadata per issuer URL
+type discoveryCache struct {
+	mutex   sync.Mutex
+	entries map[string]discoveryCacheEntry
+}
+
+// discoveryCacheEntry remembers when the metadata was fetched
+type discoveryCacheEntry struct {
+	metadata  *authtypes.ProviderMetadata
+	fetchedAt time.Time
+}
+
+// function to get the metadata of an issuer, it is fetched again once it is older than DISCOVERY_CACHE_TTL
+func (r *OAuthTokenConfigReconciler) providerMetadata(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (*authtypes.ProviderMetadata, error) {
+	log := log.FromContext(ctx)
+	issuerURL := oauthTokenConfig.Spec.IssuerURL
+
+	r.discovery.mutex.Lock()
+	entry, ok := r.discovery.entries[issuerURL]
+	r.discovery.mutex.Unlock()
+	if ok && time.Since(entry.fetchedAt) < DISCOVERY_CACHE_TTL {
+		return entry.metadata, nil
+	}
+
+	httpClient, err := r.httpClientFor(ctx, oauthTokenConfig)
+	if err != nil {
+		return nil, err
+	}
+	log.V(1).Info("Discovering authorization server metadata", "issuer", issuerURL)
+	metadata, err := authtypes.FetchProviderMetadata(ctx, httpClient, issuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r.discovery.mutex.Lock()
+	defer r.discovery.mutex.Unlock()
+	if r.discovery.entries == nil {
+		r.discovery.entries = map[string]discoveryCacheEntry{}
+	}
+	r.discovery.entries[issuerURL] = discoveryCacheEntry{metadata: metadata, fetchedAt: time.Now()}
+	return metadata, nil
+}
+
+// function to resolve the endpoints of an OAuthTokenConfig, with an issuer the grant type and client authentication
+// method are validated against the advertised metadata
+func (r *OAuthTokenConfigReconciler) resolveEndpoints(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (authtypes.Endpoints, error) {
+	var metadata *authtypes.ProviderMetadata
+	if oauthTokenConfig.Spec.IssuerURL != "" {
+		var err error
+		metadata, err = r.providerMetadata(ctx, oauthTokenConfig)
+		if err != nil {
+			return authtypes.Endpoints{}, err
+		}
+		if err := authtypes.ValidateProviderMetadata(oauthTokenConfig, metadata); err != nil {
+			return authtypes.Endpoints{}, err
+		}
+	}
+	return authtypes.ResolveEndpoints(oauthTokenConfig, metadata)
+}
@@ -2,16 +2,21 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
-	ropc "github.com/winklermichael/otto/internal/controller/auth_types/ropc"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
 	definitions "github.com/winklermichael/otto/internal/controller/definitions"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -29,6 +34,16 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// function to read integer from env or use default
+func getEnvInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsedValue, err := strconv.Atoi(value); err == nil {
+			return parsedValue
+		}
+	}
+	return defaultValue
+}
+
 // function to fetch a resource by name
 func (r *OAuthTokenConfigReconciler) fetchResource(ctx context.Context, name types.NamespacedName, obj client.Object) error {
 	log := log.FromContext(ctx)
@@ -70,6 +85,11 @@ func (r *OAuthTokenConfigReconciler) updateResource(ctx context.Context, obj cli
 func (r *OAuthTokenConfigReconciler) updateStatus(ctx context.Context, obj client.Object) error {
 	log := log.FromContext(ctx)
 	log.V(1).Info("Updating resource status", "name", obj.GetName(), "type", fmt.Sprintf("%T", obj))
+
+	// The Ready condition summarizes the other conditions and is kept up to date with every status update
+	if oauthTokenConfig, ok := obj.(*authv1alpha1.OAuthTokenConfig); ok {
+		setReadyCondition(oauthTokenConfig)
+	}
 	if err := r.Status().Update(ctx, obj); err != nil {
 		log.V(1).Info("Failed to update resource status", "name", obj.GetName(), "type", fmt.Sprintf("%T", obj), "error", err)
 		return err
@@ -78,29 +98,51 @@ func (r *OAuthTokenConfigReconciler) updateStatus(ctx context.Context, obj clien
 	return nil
 }
 
+// function to validate the grant type specific configuration
+func (r *OAuthTokenConfigReconciler) validateGrantConfig(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	log := log.FromContext(ctx)
+	log.V(1).Info("Validating grant configuration", "type", oauthTokenConfig.Spec.Type)
+
+	handler, err := authtypes.Lookup(oauthTokenConfig.Spec.Type)
+	if err != nil {
+		return fmt.Errorf("%w, supported grant types: %s", err, strings.Join(authtypes.Names(), ", "))
+	}
+	if err := authtypes.ValidateClientAuthentication(oauthTokenConfig); err != nil {
+		log.V(1).Info("Invalid client authentication", "type", oauthTokenConfig.Spec.Type, "error", err)
+		return err
+	}
+	if err := handler.Validate(oauthTokenConfig); err != nil {
+		log.V(1).Info("Invalid grant configuration", "type", oauthTokenConfig.Spec.Type, "error", err)
+		return fmt.Errorf("invalid configuration for grant type %s: %w", oauthTokenConfig.Spec.Type, err)
+	}
+
+	log.V(1).Info("Grant configuration validated successfully", "type", oauthTokenConfig.Spec.Type)
+	return nil
+}
+
 // function to validate credentials secret
 func (r *OAuthTokenConfigReconciler) validateCredentialsSecret(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, credentialsSecret corev1.Secret) error {
 	log := log.FromContext(ctx)
 	log.V(1).Info("Validating credentials secret", "name", credentialsSecret.Name, "namespace", credentialsSecret.Namespace)
 
-	// Check if the credentials secret contains the required fields
-	missingFields := []string{}
-
-	if _, ok := credentialsSecret.Data[oauthTokenConfig.Spec.Credentials.ClientIDFieldName]; !ok {
-		missingFields = append(missingFields, oauthTokenConfig.Spec.Credentials.ClientIDFieldName)
-	}
-	if _, ok := credentialsSecret.Data[oauthTokenConfig.Spec.Credentials.ClientSecretFieldName]; !ok {
-		missingFields = append(missingFields, oauthTokenConfig.Spec.Credentials.ClientSecretFieldName)
+	handler, err := authtypes.Lookup(oauthTokenConfig.Spec.Type)
+	if err != nil {
+		return err
 	}
-	if oauthTokenConfig.Spec.Type == "ropc" {
-		if _, ok := credentialsSecret.Data[oauthTokenConfig.Spec.Credentials.UsernameFieldName]; !ok {
-			missingFields = append(missingFields, oauthTokenConfig.Spec.Credentials.UsernameFieldName)
-		}
-		if _, ok := credentialsSecret.Data[oauthTokenConfig.Spec.Credentials.PasswordFieldName]; !ok {
-			missingFields = append(missingFields, oauthTokenConfig.Spec.Credentials.PasswordFieldName)
+
+	// Check if the credentials secret contains the fields required by the grant type
+	missingFields := []string{}
+	for _, field := range handler.RequiredCredentialFields(oauthTokenConfig) {
+		if _, ok := credentialsSecret.Data[field]; !ok {
+			missingFields = append(missingFields, field)
 		}
 	}
 
+	if len(missingFields) > 0 && oauthTokenConfig.Spec.Credentials.SecretRef.Name == "" {
+		log.V(1).Info("No credentials secret configured but credentials are required", "type", oauthTokenConfig.Spec.Type)
+		return fmt.Errorf("credentials.secretRef is required for grant type %s with client authentication %s", oauthTokenConfig.Spec.Type, authtypes.ClientAuthenticationMethod(oauthTokenConfig))
+	}
+
 	if len(missingFields) > 0 {
 		// Log the error and return it
 		log.V(1).Info("Missing required fields in credentials secret", "name", credentialsSecret.Name, "namespace", credentialsSecret.Namespace, "missingFields", missingFields)
@@ -113,12 +155,139 @@ func (r *OAuthTokenConfigReconciler) validateCredentialsSecret(ctx context.Conte
 }
 
 // function to refresh token
-func (r *OAuthTokenConfigReconciler) refreshToken(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, targetSecret corev1.Secret, credentialsSecret corev1.Secret) (*definitions.Tokens, error) {
+func (r *OAuthTokenConfigReconciler) refreshToken(ctx context.Context, oauthTokenConfig *authv1alpha1.OAuthTokenConfig, endpoints authtypes.Endpoints, targetSecret corev1.Secret, credentialsSecret corev1.Secret, forceAcquire bool) (*definitions.Tokens, error) {
+	log := log.FromContext(ctx)
 
-	// Decide which grant type to use based on the OAuthTokenConfig spec
-	if oauthTokenConfig.Spec.Type == "ropc" {
-		return ropc.HandleRefresh(ctx, r.HTTPClient, oauthTokenConfig, targetSecret, credentialsSecret)
+	// Look up the handler of the configured grant type
+	handler, err := authtypes.Lookup(oauthTokenConfig.Spec.Type)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := r.httpClientFor(ctx, *oauthTokenConfig)
+	if err != nil {
+		return nil, err
+	}
+	grantRequest := authtypes.GrantRequest{
+		HTTPClient:        httpClient,
+		KubeClient:        r.Client,
+		OAuthTokenConfig:  *oauthTokenConfig,
+		TargetSecret:      targetSecret,
+		CredentialsSecret: credentialsSecret,
+		Status:            &oauthTokenConfig.Status,
+		Endpoints:         endpoints,
+		State:             &r.grants,
+		Admit:             r.admitRequests(types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}),
+	}
+
+	// If there is no refresh token in the target secret or it is expired acquire a new token, else use the refresh token.
+	// A zero expiration time means the server did not report one, the refresh token is used until it is rejected
+	refreshToken := string(targetSecret.Data[oauthTokenConfig.Spec.Target.RefreshTokenFieldName])
+	refreshExpired := !oauthTokenConfig.Status.RefreshExpirationTime.IsZero() && time.Now().After(oauthTokenConfig.Status.RefreshExpirationTime.Time)
+
+	// After a rejected refresh token only new credentials can help, the stale refresh token is not sent again
+	// Changed credentials are used right away instead of continuing with a refresh token issued for the old ones
+	reauthenticationRequired := oauthTokenConfig.Status.Status == definitions.STATUS_REAUTHENTICATION_REQUIRED
+	if refreshToken == "" || refreshExpired || reauthenticationRequired || forceAcquire {
+		log.V(1).Info("Acquiring new token", "type", oauthTokenConfig.Spec.Type)
+		return handler.Acquire(ctx, grantRequest)
+	}
+
+	log.V(1).Info("Refreshing token", "type", oauthTokenConfig.Spec.Type)
+	return handler.Refresh(ctx, grantRequest, refreshToken)
+}
+
+// function to hash the subject token of grant types deriving their token from another token, empty for all other grant types
+func (r *OAuthTokenConfigReconciler) subjectTokenHash(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (string, error) {
+	handler, err := authtypes.Lookup(oauthTokenConfig.Spec.Type)
+	if err != nil {
+		return "", err
+	}
+	subjectTokenProvider, ok := handler.(authtypes.SubjectTokenProvider)
+	if !ok {
+		return "", nil
+	}
+
+	subjectToken, err := subjectTokenProvider.SubjectToken(ctx, authtypes.GrantRequest{
+		KubeClient:       r.Client,
+		OAuthTokenConfig: oauthTokenConfig,
+	})
+	if err != nil || subjectToken == "" {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(subjectToken))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// function to hash the data of a secret, the keys are sorted to get the same hash for the same data
+func secretDataHash(secret corev1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		value := secret.Data[key]
+		fmt.Fprintf(hash, "%d:%s%d:", len(key), key, len(value))
+		hash.Write(value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// function to hash the credentials secret of an OAuthTokenConfig, empty if there is none or it cannot be read.
+// A credentials secret which is also the target secret changes with every token and is not tracked
+func (r *OAuthTokenConfigReconciler) credentialsHash(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	credentialsSecretName := types.NamespacedName{
+		Name:      oauthTokenConfig.Spec.Credentials.SecretRef.Name,
+		Namespace: oauthTokenConfig.Spec.Credentials.SecretRef.Namespace,
+	}
+	targetSecretName := types.NamespacedName{
+		Name:      oauthTokenConfig.Spec.Target.SecretRef.Name,
+		Namespace: oauthTokenConfig.Spec.Target.SecretRef.Namespace,
+	}
+	if credentialsSecretName.Name == "" || credentialsSecretName == targetSecretName {
+		return ""
+	}
+
+	credentialsSecret := &corev1.Secret{}
+	if err := r.fetchResource(ctx, credentialsSecretName, credentialsSecret); err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to read credentials secret", "error", err)
+		return ""
+	}
+	return secretDataHash(*credentialsSecret)
+}
+
+// function to hash the spec fields which affect the token request, the targets, deletion policy and refresh schedule
+// can change without a new token. The additional fields of the primary target are read from the token response, the
+// cached tokens only hold the ones of the previous spec
+func tokenRequestHash(oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	spec := oauthTokenConfig.Spec.DeepCopy()
+	spec.Target = authv1alpha1.TargetConfig{AdditionalFields: spec.Target.AdditionalFields}
+	spec.AdditionalTargets = nil
+	spec.DeletionPolicy = ""
+	spec.RevocationURL = ""
+	spec.RefreshInterval = nil
+	spec.RefreshBufferPercentage = 0
+	spec.Backoff = nil
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// function to calculate the next refresh of a token, the refresh buffer is taken from its lifetime. A token without
+// expiration is only refreshed on the refresh interval if one is set
+func nextRefreshTime(oauthTokenConfig authv1alpha1.OAuthTokenConfig, issuedAt time.Time, expiresAt time.Time) metav1.Time {
+	if !expiresAt.IsZero() {
+		lifetime := expiresAt.Sub(issuedAt)
+		return metav1.NewTime(expiresAt.Add(-(time.Duration(float64(lifetime) * (float64(oauthTokenConfig.Spec.RefreshBufferPercentage) / 100)))))
+	}
+	if oauthTokenConfig.Spec.RefreshInterval != nil && oauthTokenConfig.Spec.RefreshInterval.Duration > 0 {
+		return metav1.NewTime(issuedAt.Add(oauthTokenConfig.Spec.RefreshInterval.Duration))
 	}
-	// If the type is not recognized, return an error
-	return nil, fmt.Errorf("Unsupported OAuth2 grant type: %s", oauthTokenConfig.Spec.Type)
+	return metav1.Time{}
 }
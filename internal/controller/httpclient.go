@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// httpClientCache holds the per-resource HTTP clients of OAuthTokenConfigs using mutual TLS
+type httpClientCache struct {
+	mutex   sync.Mutex
+	entries map[types.NamespacedName]httpClientCacheEntry
+}
+
+// httpClientCacheEntry remembers the TLS secret version a client was built from
+type httpClientCacheEntry struct {
+	secretUID             types.UID
+	secretResourceVersion string
+	client                *http.Client
+}
+
+// function to get the HTTP client for an OAuthTokenConfig, a client certificate from the TLS secret is presented if configured
+func (r *OAuthTokenConfigReconciler) httpClientFor(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (*http.Client, error) {
+	if oauthTokenConfig.Spec.TLS == nil {
+		return r.HTTPClient, nil
+	}
+	log := log.FromContext(ctx)
+
+	// Fetch the TLS secret
+	tlsSecretName := types.NamespacedName{
+		Name:      oauthTokenConfig.Spec.TLS.SecretRef.Name,
+		Namespace: oauthTokenConfig.Spec.TLS.SecretRef.Namespace,
+	}
+	tlsSecret := &corev1.Secret{}
+	if err := r.fetchResource(ctx, tlsSecretName, tlsSecret); err != nil {
+		return nil, fmt.Errorf("failed to fetch TLS secret %s: %w", tlsSecretName, err)
+	}
+
+	key := types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}
+	r.httpClients.mutex.Lock()
+	defer r.httpClients.mutex.Unlock()
+	if r.httpClients.entries == nil {
+		r.httpClients.entries = map[types.NamespacedName]httpClientCacheEntry{}
+	}
+
+	// Reuse the client as long as the secret did not change, a rotated certificate results in a new client
+	entry, ok := r.httpClients.entries[key]
+	if ok && entry.secretUID == tlsSecret.UID && entry.secretResourceVersion == tlsSecret.ResourceVersion {
+		return entry.client, nil
+	}
+
+	log.V(1).Info("Building HTTP client with client certificate", "TLSSecret", tlsSecretName, "resourceVersion", tlsSecret.ResourceVersion)
+	client, err := r.newMTLSClient(*tlsSecret)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		entry.client.CloseIdleConnections()
+	}
+	r.httpClients.entries[key] = httpClientCacheEntry{
+		secretUID:             tlsSecret.UID,
+		secretResourceVersion: tlsSecret.ResourceVersion,
+		client:                client,
+	}
+	return client, nil
+}
+
+// function to forget the HTTP client of a deleted OAuthTokenConfig
+func (r *OAuthTokenConfigReconciler) forgetHTTPClient(name types.NamespacedName) {
+	r.httpClients.mutex.Lock()
+	defer r.httpClients.mutex.Unlock()
+
+	if entry, ok := r.httpClients.entries[name]; ok {
+		entry.client.CloseIdleConnections()
+		delete(r.httpClients.entries, name)
+	}
+}
+
+// function to build an HTTP client presenting the certificate of the TLS secret
+func (r *OAuthTokenConfigReconciler) newMTLSClient(tlsSecret corev1.Secret) (*http.Client, error) {
+	certificate, err := tls.X509KeyPair(tlsSecret.Data[corev1.TLSCertKey], tlsSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate from TLS secret %s/%s: %w", tlsSecret.Namespace, tlsSecret.Name, err)
+	}
+
+	// Start from the shared client so its timeout and transport settings apply
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	timeout := HTTP_CLIENT_TIMEOUT
+	if r.HTTPClient != nil {
+		timeout = r.HTTPClient.Timeout
+		if baseTransport, ok := r.HTTPClient.Transport.(*http.Transport); ok {
+			transport = baseTransport.Clone()
+		}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+	tlsConfig.Certificates = []tls.Certificate{certificate}
+
+	// Verify the authorization server with the CA of the secret if present
+	if caBundle, ok := tlsSecret.Data["ca.crt"]; ok && len(caBundle) > 0 {
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("failed to parse ca.crt of TLS secret %s/%s", tlsSecret.Namespace, tlsSecret.Name)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
@@ -2,19 +2,26 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
 	definitions "github.com/winklermichael/otto/internal/controller/definitions"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -24,11 +31,33 @@ type OAuthTokenConfigReconciler struct {
 	Scheme        *runtime.Scheme
 	EventRecorder record.EventRecorder
 	HTTPClient    *http.Client
+
+	// shared rate limit and circuit breaker of the token endpoints, nil disables both
+	EndpointLimiter *EndpointLimiter
+
+	// per-resource HTTP clients for mutual TLS
+	httpClients httpClientCache
+
+	// authorization server metadata per issuer
+	discovery discoveryCache
+
+	// last tokens per resource for the additional targets
+	tokens tokenCache
+
+	// pending interactive grants per resource, e.g. device authorizations
+	grants authtypes.GrantState
+
+	// delays of the next retries per failed resource for the rate limiter
+	retries retryDelays
 }
 
 var (
 	REQUEUE_TIME        = getEnvDuration("REQUEUE_TIME", 30*time.Second)
 	HTTP_CLIENT_TIMEOUT = getEnvDuration("HTTP_CLIENT_TIMEOUT", 10*time.Second)
+	DISCOVERY_CACHE_TTL = getEnvDuration("DISCOVERY_CACHE_TTL", time.Hour)
+	BACKOFF_MAX_TIME    = getEnvDuration("BACKOFF_MAX_TIME", 15*time.Minute)
+
+	REVOCATION_MAX_ATTEMPTS = getEnvInt("REVOCATION_MAX_ATTEMPTS", 5)
 )
 
 // +kubebuilder:rbac:groups=auth.example.com,resources=oauthtokenconfigs,verbs=get;list;watch;create;update;patch;delete
@@ -36,6 +65,9 @@ var (
 // +kubebuilder:rbac:groups=auth.example.com,resources=oauthtokenconfigs/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch;update;delete
+// +kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 /* MAIN RECONCILER FUNCTION */
 
@@ -48,29 +80,258 @@ func (r *OAuthTokenConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	// Fetch the OAuthTokenConfig resource
 	var oauthTokenConfig authv1alpha1.OAuthTokenConfig
 	if err := r.fetchResource(ctx, req.NamespacedName, &oauthTokenConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The resource was deleted after its finalizer was removed, nothing is left to reconcile
+			r.forgetHTTPClient(req.NamespacedName)
+			r.forgetTokens(req.NamespacedName)
+			r.grants.Forget(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
 		log.Error(err, "Failed to fetch OAuthTokenConfig", "OAuthTokenConfig", req.NamespacedName, "Error", err)
 		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceFetchFailed", fmt.Sprintf("Failed to fetch OAuthTokenConfig: %v", err))
 
 		return ctrl.Result{}, err
 	}
 
+	// Apply the deletion policy to the targets before the resource is removed
+	if !oauthTokenConfig.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&oauthTokenConfig, definitions.FINALIZER) {
+			// A failed revocation waits for its next attempt, events of its own status update do not retry it early
+			skipRevocation := oauthTokenConfig.Annotations[definitions.ANNOTATION_SKIP_REVOCATION] == "true"
+			if oauthTokenConfig.Status.RevocationAttempts > 0 && !skipRevocation && time.Now().Before(oauthTokenConfig.Status.NextRetry.Time) {
+				log.Info("Waiting for the next revocation attempt", "nextRetry", oauthTokenConfig.Status.NextRetry.Time)
+				return ctrl.Result{RequeueAfter: time.Until(oauthTokenConfig.Status.NextRetry.Time)}, nil
+			}
+
+			revoked, err := r.revokeTokens(ctx, oauthTokenConfig)
+			if err != nil {
+				oauthTokenConfig.Status.RevocationAttempts++
+				if int(oauthTokenConfig.Status.RevocationAttempts) < REVOCATION_MAX_ATTEMPTS {
+					log.Error(err, "Failed to revoke tokens", "Attempt", oauthTokenConfig.Status.RevocationAttempts, "Error", err)
+					r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "RevocationFailed", fmt.Sprintf("Failed to revoke tokens (attempt %d of %d): %v", oauthTokenConfig.Status.RevocationAttempts, REVOCATION_MAX_ATTEMPTS, err))
+					oauthTokenConfig.Status.NextRetry = metav1.NewTime(time.Now().Add(REQUEUE_TIME))
+					if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+						log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+						return ctrl.Result{}, updateErr
+					}
+
+					// Requeue the reconciliation at the next attempt, an error would requeue it right away
+					return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
+				}
+
+				// The deletion must not be blocked forever by an authorization server which is down for good
+				log.Error(err, "Giving up revoking tokens", "Attempts", oauthTokenConfig.Status.RevocationAttempts, "Error", err)
+				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "RevocationAbandoned", fmt.Sprintf("Giving up revoking tokens after %d attempts: %v", oauthTokenConfig.Status.RevocationAttempts, err))
+			} else if revoked {
+				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "TokensRevoked", "Tokens revoked at the authorization server")
+			}
+
+			if err := r.finalizeTargets(ctx, oauthTokenConfig); err != nil {
+				log.Error(err, "Failed to clean up targets", "Error", err)
+				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "CleanupFailed", fmt.Sprintf("Failed to clean up targets: %v", err))
+				return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
+			}
+			controllerutil.RemoveFinalizer(&oauthTokenConfig, definitions.FINALIZER)
+			if err := r.updateResource(ctx, &oauthTokenConfig); err != nil {
+				log.Error(err, "Failed to remove finalizer", "Error", err)
+				return ctrl.Result{}, err
+			}
+		}
+		r.forgetHTTPClient(req.NamespacedName)
+		r.forgetTokens(req.NamespacedName)
+		r.grants.Forget(req.NamespacedName)
+		log.Info("Targets cleaned up", "deletionPolicy", deletionPolicy(oauthTokenConfig))
+		return ctrl.Result{}, nil
+	}
+
+	// Add the finalizer to apply the deletion policy when the resource is deleted
+	if !controllerutil.ContainsFinalizer(&oauthTokenConfig, definitions.FINALIZER) {
+		controllerutil.AddFinalizer(&oauthTokenConfig, definitions.FINALIZER)
+		if err := r.updateResource(ctx, &oauthTokenConfig); err != nil {
+			log.Error(err, "Failed to add finalizer", "Error", err)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to add finalizer: %v", err))
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Emit an event indicating the reconciliation has started
 	log.Info("Starting reconciliation")
 	r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ReconciliationStarted", "Starting reconciliation")
 
-	// Check if the current time is after the NextRefresh timestamp
+	// Grant types like token-exchange derive their token from a subject token, a changed subject token bypasses the schedule
+	subjectTokenHash, err := r.subjectTokenHash(ctx, oauthTokenConfig)
+	if err != nil {
+		log.V(1).Info("Failed to read subject token", "error", err)
+	}
+	subjectTokenChanged := subjectTokenHash != "" && subjectTokenHash != oauthTokenConfig.Status.SubjectTokenHash
+	if subjectTokenChanged && oauthTokenConfig.Status.SubjectTokenHash != "" {
+		log.Info("Subject token changed, exchanging it again")
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "SubjectTokenChanged", "Subject token changed, exchanging it again")
+	}
+
+	// Rotated credentials bypass the schedule and acquire a new token instead of refreshing the one of the old credentials
+	credentialsHash := r.credentialsHash(ctx, oauthTokenConfig)
+	credentialsChanged := credentialsHash != "" && oauthTokenConfig.Status.CredentialsHash != "" && credentialsHash != oauthTokenConfig.Status.CredentialsHash
+	if credentialsChanged {
+		log.Info("Credentials changed, authenticating again")
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "CredentialsChanged", "Credentials changed, authenticating again")
+	}
+
+	// A changed spec bypasses the schedule. Changes of the token request, e.g. the tokenUrl or scope, acquire a new token,
+	// changes of the targets or the refresh schedule move the current token to the new targets
+	specChanged := oauthTokenConfig.Generation != oauthTokenConfig.Status.ObservedGeneration
+	requestHash := tokenRequestHash(oauthTokenConfig)
+	requestChanged := specChanged && oauthTokenConfig.Status.TokenRequestHash != "" && requestHash != oauthTokenConfig.Status.TokenRequestHash
+	if requestChanged {
+		log.Info("Token request changed, requesting a new token")
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "SpecChanged", "Token request changed, requesting a new token")
+	}
+
+	// A failed resource waits for its next retry, events of its own status update or the target secrets do not retry
+	// it early. Changes of the spec since the failure, the credentials or the subject token are retried right away
+	ready := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_READY)
+	failedGeneration := ready != nil && ready.ObservedGeneration == oauthTokenConfig.Generation
+	if oauthTokenConfig.Status.Status == definitions.STATUS_FAILED && time.Now().Before(oauthTokenConfig.Status.NextRetry.Time) &&
+		failedGeneration && !subjectTokenChanged && !credentialsChanged {
+		log.Info("Waiting for the next retry", "nextRetry", oauthTokenConfig.Status.NextRetry.Time)
+		return ctrl.Result{RequeueAfter: time.Until(oauthTokenConfig.Status.NextRetry.Time)}, nil
+	}
+
+	// Tokens issued by a previous reconciliation whose target or status could not be written are written again instead
+	// of requesting new ones. A change of the token request, the credentials or the subject token discards them
+	unwritten, issuedAt := r.unwrittenTokens(req.NamespacedName)
+	if unwritten != nil && (subjectTokenChanged || credentialsChanged || requestChanged) {
+		unwritten = nil
+	}
+
+	// A token without expiration and refresh interval stays valid once it was acquired
 	currentTime := time.Now()
-	if !oauthTokenConfig.Status.NextRefresh.IsZero() && currentTime.Before(oauthTokenConfig.Status.NextRefresh.Time) {
-		log.Info("Skipping reconciliation", "nextRefresh", oauthTokenConfig.Status.NextRefresh.Time)
-		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ReconciliationSkipped", fmt.Sprintf("Skipping reconciliation, next refresh: %s", oauthTokenConfig.Status.NextRefresh.Time))
+	neverExpires := oauthTokenConfig.Status.Status == definitions.STATUS_REFRESHED && oauthTokenConfig.Status.NextRefresh.IsZero() && oauthTokenConfig.Status.ExpirationTime.IsZero()
+	refreshDue := oauthTokenConfig.Status.NextRefresh.IsZero() || !currentTime.Before(oauthTokenConfig.Status.NextRefresh.Time)
+
+	// After a restart no token is cached, a renamed primary target takes the tokens from the secret of its old name
+	if specChanged && !requestChanged && unwritten == nil {
+		recovered, err := r.recoverRenamedTokens(ctx, oauthTokenConfig)
+		if err != nil {
+			log.V(1).Info("Failed to read the tokens of a removed target", "error", err)
+		} else if recovered {
+			log.Info("Read the tokens from the secret of a removed target")
+		}
+	}
+
+	// After a restart no token is cached, a deleted or edited primary target is restored with a new token request
+	targetLost := !oauthTokenConfig.Status.LastRefresh.IsZero() && r.primaryTargetLost(ctx, oauthTokenConfig)
+	if targetLost {
+		log.Info("Target secret lost the token and none is cached, requesting a new token")
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "TargetLost", "Target secret lost the token and none is cached, requesting a new token")
+	}
+	if unwritten == nil && !targetLost && !subjectTokenChanged && !credentialsChanged && !requestChanged && (neverExpires || !refreshDue) {
+		// Targets are written from the last token, e.g. for a new namespace, a renamed target or after a target secret was
+		// deleted or edited. Without one after a restart a new token is requested for additional targets and a changed spec,
+		// unless the tokens of a renamed target were read above
+		cached, err := r.syncCachedTargets(ctx, oauthTokenConfig)
+		skip := cached || (!hasTargetCopies(oauthTokenConfig) && !specChanged)
+		if cached {
+			if updateErr := r.updateTargetWrittenCondition(ctx, &oauthTokenConfig, err); updateErr != nil {
+				log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+				return ctrl.Result{}, updateErr
+			}
+		}
+		if err != nil {
+			log.Error(err, "Failed to write targets", "Error", err)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "TargetsFailed", fmt.Sprintf("Failed to write targets: %v", err))
+			return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
+		}
 
-		if time.Until(oauthTokenConfig.Status.NextRefresh.Time) <= 0 {
-			return ctrl.Result{Requeue: true}, nil
+		// Targets which were removed from the spec or whose namespace is no longer selected are released
+		if cached {
+			if err := r.pruneTargets(ctx, oauthTokenConfig); err != nil {
+				log.Error(err, "Failed to clean up removed targets", "Error", err)
+				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "CleanupFailed", fmt.Sprintf("Failed to clean up removed targets: %v", err))
+				return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
+			}
 		}
 
-		return ctrl.Result{
-			RequeueAfter: time.Until(oauthTokenConfig.Status.NextRefresh.Time),
-		}, nil
+		// The targets of the changed spec hold the token now and the schedule is recalculated
+		if cached && specChanged {
+			oauthTokenConfig.Status.NextRefresh = nextRefreshTime(oauthTokenConfig, oauthTokenConfig.Status.LastRefresh.Time, oauthTokenConfig.Status.ExpirationTime.Time)
+			oauthTokenConfig.Status.TokenRequestHash = requestHash
+			oauthTokenConfig.Status.WrittenTarget = writtenTarget(oauthTokenConfig)
+			oauthTokenConfig.Status.ObservedGeneration = oauthTokenConfig.Generation
+			if err := r.updateStatus(ctx, &oauthTokenConfig); err != nil {
+				log.Error(err, "Failed to update OAuthTokenConfig status", "Error", err)
+				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", err))
+				return ctrl.Result{}, err
+			}
+			log.Info("Spec changed, targets written from the current token")
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "TargetsMoved", "Spec changed, targets written from the current token")
+
+			// A shorter refresh interval or a larger refresh buffer may make the refresh due right away
+			neverExpires = oauthTokenConfig.Status.NextRefresh.IsZero() && oauthTokenConfig.Status.ExpirationTime.IsZero()
+			skip = neverExpires || currentTime.Before(oauthTokenConfig.Status.NextRefresh.Time)
+		}
+
+		if skip && neverExpires {
+			log.Info("Skipping reconciliation, the token does not expire")
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ReconciliationSkipped", "Skipping reconciliation, the token does not expire")
+			return ctrl.Result{}, nil
+		}
+		if skip {
+			log.Info("Skipping reconciliation", "nextRefresh", oauthTokenConfig.Status.NextRefresh.Time)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ReconciliationSkipped", fmt.Sprintf("Skipping reconciliation, next refresh: %s", oauthTokenConfig.Status.NextRefresh.Time))
+
+			if time.Until(oauthTokenConfig.Status.NextRefresh.Time) <= 0 {
+				return ctrl.Result{Requeue: true}, nil
+			}
+
+			return ctrl.Result{
+				RequeueAfter: time.Until(oauthTokenConfig.Status.NextRefresh.Time),
+			}, nil
+		}
+	}
+
+	// Validate the grant type specific configuration
+	if err := r.validateGrantConfig(ctx, oauthTokenConfig); err != nil {
+		log.Error(err, "Grant configuration validation failed", "Type", oauthTokenConfig.Spec.Type, "Error", err)
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceValidationFailed", fmt.Sprintf("Grant configuration validation failed: %v", err))
+
+		// Set CRD status to FAILED
+		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_TOKEN_ACQUIRED, definitions.REASON_INVALID_CONFIGURATION, err)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
+
+		// Requeue the reconciliation at the next retry of the backoff policy
+		return r.retryResult(oauthTokenConfig, err)
+	}
+
+	// Resolve the endpoints of the authorization server
+	endpoints, err := r.resolveEndpoints(ctx, oauthTokenConfig)
+	if err != nil {
+		log.Error(err, "Failed to resolve endpoints", "Issuer", oauthTokenConfig.Spec.IssuerURL, "Error", err)
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "DiscoveryFailed", fmt.Sprintf("Failed to resolve endpoints: %v", err))
+
+		// Set CRD status to FAILED
+		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_TOKEN_ACQUIRED, requestFailureReason(err, definitions.REASON_DISCOVERY_FAILED), err)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
+
+		// Requeue the reconciliation at the next retry of the backoff policy
+		return r.retryResult(oauthTokenConfig, err)
+	}
+	oauthTokenConfig.Status.Endpoints = &authv1alpha1.EndpointsStatus{
+		Token:               endpoints.Token,
+		Revocation:          endpoints.Revocation,
+		Introspection:       endpoints.Introspection,
+		DeviceAuthorization: endpoints.DeviceAuthorization,
+		JWKS:                endpoints.JWKS,
 	}
 
 	// Fetch the target secret
@@ -85,34 +346,38 @@ func (r *OAuthTokenConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 		// Set CRD status to FAILED
 		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_TARGET_WRITTEN, definitions.REASON_API_ERROR, err)
 		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
 			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
 			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
 			return ctrl.Result{}, updateErr
 		}
 
-		return ctrl.Result{}, err
+		return r.retryResult(oauthTokenConfig, err)
 	}
 
-	// Fetch the credentials secret
+	// Fetch the credentials secret, it is optional if the grant needs no stored credentials
 	credentialsSecretName := types.NamespacedName{
 		Name:      oauthTokenConfig.Spec.Credentials.SecretRef.Name,
 		Namespace: oauthTokenConfig.Spec.Credentials.SecretRef.Namespace,
 	}
 	credentialsSecret := &corev1.Secret{}
-	if err := r.fetchResource(ctx, credentialsSecretName, credentialsSecret); err != nil {
+	if credentialsSecretName.Name == "" {
+		log.V(1).Info("No credentials secret configured")
+	} else if err := r.fetchResource(ctx, credentialsSecretName, credentialsSecret); err != nil {
 		log.Error(err, "Failed to fetch CredentialsSecret", "CredentialsSecret", credentialsSecretName, "Error", err)
 		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceFetchFailed", fmt.Sprintf("Failed to fetch CredentialsSecret: %v", err))
 
 		// Set CRD status to FAILED
 		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_CREDENTIALS_VALID, secretFailureReason(err), err)
 		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
 			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
 			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
 			return ctrl.Result{}, updateErr
 		}
 
-		return ctrl.Result{}, err
+		return r.retryResult(oauthTokenConfig, err)
 	}
 	// Validate the credentials secret
 	if err := r.validateCredentialsSecret(ctx, oauthTokenConfig, *credentialsSecret); err != nil {
@@ -121,88 +386,214 @@ func (r *OAuthTokenConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 		// Set CRD status to FAILED
 		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_CREDENTIALS_VALID, definitions.REASON_INVALID_SECRET, err)
 		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
 			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
 			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
 			return ctrl.Result{}, updateErr
 		}
 
-		// Requeue the reconciliation after a short delay to retry
-		return ctrl.Result{RequeueAfter: REQUEUE_TIME}, err
+		// Requeue the reconciliation at the next retry of the backoff policy
+		return r.retryResult(oauthTokenConfig, err)
 	}
 
+	setCondition(&oauthTokenConfig, definitions.CONDITION_CREDENTIALS_VALID, metav1.ConditionTrue, definitions.REASON_VALID, "Credentials secret is valid")
+
+	// Validate the target configuration
+	if err := validateTarget(oauthTokenConfig, *targetSecret); err != nil {
+		log.Error(err, "Target validation failed", "TargetSecret", targetSecretName, "Error", err)
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceValidationFailed", fmt.Sprintf("Target validation failed: %v", err))
+
+		// Set CRD status to FAILED
+		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_TARGET_WRITTEN, definitions.REASON_INVALID_CONFIGURATION, err)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
+
+		// Requeue the reconciliation at the next retry of the backoff policy
+		return r.retryResult(oauthTokenConfig, err)
+	}
+
+	// Token requests to the same host share a rate limit and a circuit breaker, they are admitted right before they are
+	// sent so reconciliations without a request, e.g. a device authorization waiting for its poll interval, use no slot
+	host := endpointHost(endpoints.Token)
+
 	// Get current timestamp
 	now := metav1.Now()
 
-	// Fetch new tokens
-	tokens, err := r.refreshToken(ctx, oauthTokenConfig, *targetSecret, *credentialsSecret)
+	// Fetch new tokens, unless the last ones were not written yet
+	tokens := unwritten
+	if unwritten != nil {
+		log.Info("Writing the unwritten tokens of the last token request", "issuedAt", issuedAt)
+		now = metav1.NewTime(issuedAt)
+		err = nil
+	} else {
+		tokens, err = r.refreshToken(ctx, &oauthTokenConfig, endpoints, *targetSecret, *credentialsSecret, credentialsChanged || requestChanged)
+		if r.EndpointLimiter.Record(host, err, time.Now()) {
+			log.Info("Circuit opened, pausing token requests", "host", host)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "CircuitOpened", fmt.Sprintf("Token requests to %s failed repeatedly, pausing them for all resources", host))
+		}
+	}
+	var throttledErr *authtypes.ThrottledError
+	if errors.As(err, &throttledErr) {
+		// A throttled resource waits for its turn
+		log.Info("Token request throttled", "host", host, "reason", throttledErr.Reason, "retryAfter", throttledErr.RetryAfter)
+		if setCondition(&oauthTokenConfig, definitions.CONDITION_THROTTLED, metav1.ConditionTrue, throttledErr.Reason, throttledErr.Message) {
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "Throttled", throttledErr.Message)
+		}
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
+
+		return ctrl.Result{RequeueAfter: throttledErr.RetryAfter}, nil
+	}
+	if unwritten == nil {
+		setCondition(&oauthTokenConfig, definitions.CONDITION_THROTTLED, metav1.ConditionFalse, definitions.REASON_NOT_THROTTLED, "Token requests are not throttled")
+	}
+	var pendingErr *authtypes.AuthorizationPendingError
+	if errors.As(err, &pendingErr) {
+		// The grant waits for an action outside of the controller, e.g. the user completing a device authorization
+		log.Info("Authorization pending", "message", pendingErr.Message, "retryAfter", pendingErr.RetryAfter)
+		if pendingErr.Reason != "" {
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, pendingErr.Reason, pendingErr.Message)
+		}
+
+		// Set CRD status to PENDING
+		oauthTokenConfig.Status.Status = definitions.STATUS_PENDING
+		setCondition(&oauthTokenConfig, definitions.CONDITION_TOKEN_ACQUIRED, metav1.ConditionFalse, definitions.REASON_AUTHORIZATION_PENDING, pendingErr.Message)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
+
+		return ctrl.Result{RequeueAfter: pendingErr.RetryAfter}, nil
+	}
+	var reauthenticationErr *authtypes.ReauthenticationRequiredError
+	if errors.As(err, &reauthenticationErr) {
+		// Retrying the token request cannot succeed until the credentials change, only warn once per transition
+		log.Info("Reauthentication required", "message", reauthenticationErr.Message)
+		if oauthTokenConfig.Status.Status != definitions.STATUS_REAUTHENTICATION_REQUIRED {
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ReauthenticationRequired", reauthenticationErr.Message)
+			oauthTokenConfig.Status.ConsecutiveFailures++
+		}
+
+		// Set CRD status to REAUTHENTICATION_REQUIRED
+		oauthTokenConfig.Status.Status = definitions.STATUS_REAUTHENTICATION_REQUIRED
+		setCondition(&oauthTokenConfig, definitions.CONDITION_TOKEN_ACQUIRED, metav1.ConditionFalse, definitions.REASON_REAUTHENTICATION_REQUIRED, reauthenticationErr.Message)
+		setCondition(&oauthTokenConfig, definitions.CONDITION_REFRESH_TOKEN_VALID, metav1.ConditionFalse, definitions.REASON_INVALID_GRANT, reauthenticationErr.Message)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
+
+		// Check again later whether new credentials were provided
+		return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
+	}
 	if err != nil {
 		log.Error(err, "Failed to refresh token", "Error", err)
 		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "TokenRefreshFailed", fmt.Sprintf("Failed to refresh token: %v", err))
 
 		// Set CRD status to FAILED
 		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_TOKEN_ACQUIRED, requestFailureReason(err, definitions.REASON_TOKEN_REQUEST_FAILED), err)
 		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
 			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
 			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
 			return ctrl.Result{}, updateErr
 		}
 
-		// Requeue the reconciliation after a short delay to retry
-		return ctrl.Result{RequeueAfter: REQUEUE_TIME}, err
+		// Requeue the reconciliation at the next retry of the backoff policy
+		return r.retryResult(oauthTokenConfig, err)
 	}
 	log.Info("Tokens refreshed successfully")
+	r.cacheIssuedTokens(req.NamespacedName, tokens, now.Time)
 
-	// Update/Create target secret
-	targetSecretExists := targetSecret.Data != nil
-	if !targetSecretExists {
-		targetSecret.Data = make(map[string][]byte)
-		targetSecret.Name = oauthTokenConfig.Spec.Target.SecretRef.Name
-		targetSecret.Namespace = oauthTokenConfig.Spec.Target.SecretRef.Namespace
-	}
-	targetSecret.Data[oauthTokenConfig.Spec.Target.AccessTokenFieldName] = []byte(tokens.AccessToken)
-	targetSecret.Data[oauthTokenConfig.Spec.Target.RefreshTokenFieldName] = []byte(tokens.RefreshToken)
+	// Render the templated keys of the target secret
+	renderedKeys, err := renderTargetTemplates(oauthTokenConfig.Spec.Target, tokens, *credentialsSecret)
+	if err != nil {
+		log.Error(err, "Failed to render target templates", "Error", err)
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "TemplateRenderFailed", fmt.Sprintf("Failed to render target templates: %v", err))
 
-	if !targetSecretExists {
-		if err := r.createResource(ctx, targetSecret); err != nil {
-			log.Error(err, "Failed to create target secret", "TargetSecret", targetSecret.Name, "Error", err)
-			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceCreationFailed", fmt.Sprintf("Failed to create target secret: %v", err))
+		// Set CRD status to FAILED
+		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		recordFailure(&oauthTokenConfig, definitions.CONDITION_TARGET_WRITTEN, definitions.REASON_INVALID_CONFIGURATION, err)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
+		}
 
-			// Set CRD status to FAILED
-			oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
-			if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
-				log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
-				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
-				return ctrl.Result{}, updateErr
-			}
+		// Requeue the reconciliation at the next retry of the backoff policy
+		return r.retryResult(oauthTokenConfig, err)
+	}
 
-			return ctrl.Result{}, err
+	// Write the target secret with server-side apply, keys of other writers are kept
+	targetSecretExists := targetSecret.ResourceVersion != ""
+	if err := r.writeTargetSecret(ctx, oauthTokenConfig, targetSecretName, oauthTokenConfig.Spec.Target, tokens, renderedKeys, true); err != nil {
+		reason := "ResourceUpdateFailed"
+		if !targetSecretExists {
+			reason = "ResourceCreationFailed"
 		}
-		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ResourceCreated", fmt.Sprintf("Target secret %s created successfully", targetSecret.Name))
-	} else {
-		if err := r.updateResource(ctx, targetSecret); err != nil {
-			log.Error(err, "Failed to update target secret", "TargetSecret", targetSecret.Name, "Error", err)
-			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update target secret: %v", err))
-
-			// Set CRD status to FAILED
-			oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
-			if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
-				log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
-				r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
-				return ctrl.Result{}, updateErr
-			}
+		var conflictErr *TargetConflictError
+		if errors.As(err, &conflictErr) {
+			reason = "TargetConflict"
+		}
+		log.Error(err, "Failed to write target secret", "TargetSecret", targetSecretName, "Error", err)
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, reason, fmt.Sprintf("Failed to write target secret: %v", err))
 
-			return ctrl.Result{}, err
+		// Set CRD status to FAILED
+		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		scheduleRetry(&oauthTokenConfig, err)
+		setTargetWrittenCondition(&oauthTokenConfig, err)
+		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
+			return ctrl.Result{}, updateErr
 		}
-		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ResourceUpdated", fmt.Sprintf("Target secret %s updated successfully", targetSecret.Name))
+
+		return r.retryResult(oauthTokenConfig, err)
+	}
+	if targetSecretExists {
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ResourceUpdated", fmt.Sprintf("Target secret %s updated successfully", targetSecretName.Name))
+	} else {
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeNormal, "ResourceCreated", fmt.Sprintf("Target secret %s created successfully", targetSecretName.Name))
 	}
+	setTargetWrittenCondition(&oauthTokenConfig, nil)
 
 	// Update CRD
 	oauthTokenConfig.Status.LastRefresh = now
-	oauthTokenConfig.Status.ExpirationTime = metav1.NewTime(now.Add(time.Duration(tokens.ExpiresIn) * time.Second))
-	oauthTokenConfig.Status.NextRefresh = metav1.NewTime(oauthTokenConfig.Status.ExpirationTime.Time.Add(-(time.Duration(float64(tokens.ExpiresIn) * float64(time.Second) * (float64(oauthTokenConfig.Spec.RefreshBufferPercentage) / 100)))))
-	oauthTokenConfig.Status.RefreshExpirationTime = metav1.NewTime(now.Add(time.Duration(tokens.RefreshExpiresIn) * time.Second))
+	oauthTokenConfig.Status.ExpirationTime = metav1.Time{}
+	if !tokens.ExpiresAt.IsZero() {
+		oauthTokenConfig.Status.ExpirationTime = metav1.NewTime(tokens.ExpiresAt)
+	}
+	oauthTokenConfig.Status.NextRefresh = nextRefreshTime(oauthTokenConfig, now.Time, tokens.ExpiresAt)
+	if tokens.RefreshToken != "" && !tokens.RefreshExpiresAt.IsZero() {
+		oauthTokenConfig.Status.RefreshExpirationTime = metav1.NewTime(tokens.RefreshExpiresAt)
+	} else {
+		oauthTokenConfig.Status.RefreshExpirationTime = metav1.Time{}
+	}
 	oauthTokenConfig.Status.Status = definitions.STATUS_REFRESHED
+	oauthTokenConfig.Status.ConsecutiveFailures = 0
+	oauthTokenConfig.Status.NextRetry = metav1.Time{}
+	setCondition(&oauthTokenConfig, definitions.CONDITION_TOKEN_ACQUIRED, metav1.ConditionTrue, definitions.REASON_ACQUIRED, "Token acquired")
+	if tokens.RefreshToken != "" {
+		setCondition(&oauthTokenConfig, definitions.CONDITION_REFRESH_TOKEN_VALID, metav1.ConditionTrue, definitions.REASON_VALID, "Refresh token issued")
+	} else {
+		setCondition(&oauthTokenConfig, definitions.CONDITION_REFRESH_TOKEN_VALID, metav1.ConditionFalse, definitions.REASON_NOT_ISSUED, "The grant returned no refresh token")
+	}
+	oauthTokenConfig.Status.SubjectTokenHash = subjectTokenHash
+	oauthTokenConfig.Status.CredentialsHash = credentialsHash
+	oauthTokenConfig.Status.TokenRequestHash = requestHash
+	oauthTokenConfig.Status.WrittenTarget = writtenTarget(oauthTokenConfig)
+	oauthTokenConfig.Status.ObservedGeneration = oauthTokenConfig.Generation
+	oauthTokenConfig.Status.GrantedScope = tokens.Scope
 
 	if err := r.updateStatus(ctx, &oauthTokenConfig); err != nil {
 		log.Error(err, "Failed to update OAuthTokenConfig", "Error", err)
@@ -210,13 +601,37 @@ func (r *OAuthTokenConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 		// Set CRD status to FAILED
 		oauthTokenConfig.Status.Status = definitions.STATUS_FAILED
+		scheduleRetry(&oauthTokenConfig, err)
 		if updateErr := r.updateStatus(ctx, &oauthTokenConfig); updateErr != nil {
 			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
 			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "ResourceUpdateFailed", fmt.Sprintf("Failed to update OAuthTokenConfig status: %v", updateErr))
 			return ctrl.Result{}, updateErr
 		}
 
-		return ctrl.Result{}, err
+		return r.retryResult(oauthTokenConfig, err)
+	}
+	r.cacheTokens(req.NamespacedName, tokens)
+
+	// Write the additional targets, the token is valid already so a failure only delays them
+	if hasTargetCopies(oauthTokenConfig) {
+		err := r.syncTargetCopies(ctx, oauthTokenConfig, tokens, *credentialsSecret)
+		if updateErr := r.updateTargetWrittenCondition(ctx, &oauthTokenConfig, err); updateErr != nil {
+			log.Error(updateErr, "Failed to update OAuthTokenConfig status", "Error", updateErr)
+			return ctrl.Result{}, updateErr
+		}
+		if err != nil {
+			log.Error(err, "Failed to write additional targets", "Error", err)
+			r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "AdditionalTargetsFailed", fmt.Sprintf("Failed to write additional targets: %v", err))
+			return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
+		}
+	}
+
+	// Release the targets which were removed from the spec or whose namespace is no longer selected, e.g. the old secret
+	// of a renamed target
+	if err := r.pruneTargets(ctx, oauthTokenConfig); err != nil {
+		log.Error(err, "Failed to clean up removed targets", "Error", err)
+		r.EventRecorder.Event(&oauthTokenConfig, corev1.EventTypeWarning, "CleanupFailed", fmt.Sprintf("Failed to clean up removed targets: %v", err))
+		return ctrl.Result{RequeueAfter: REQUEUE_TIME}, nil
 	}
 
 	// Finalize Reconciliation
@@ -227,7 +642,7 @@ func (r *OAuthTokenConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	requeueAfter := time.Duration(0)
 	if oauthTokenConfig.Spec.RefreshInterval != nil && oauthTokenConfig.Spec.RefreshInterval.Duration > 0 {
 		requeueAfter = oauthTokenConfig.Spec.RefreshInterval.Duration
-	} else {
+	} else if !oauthTokenConfig.Status.NextRefresh.IsZero() {
 		requeueAfter = time.Until(oauthTokenConfig.Status.NextRefresh.Time)
 	}
 
@@ -247,7 +662,18 @@ func (r *OAuthTokenConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		}
 	}
 
+	// Index the secrets each OAuthTokenConfig reads or writes to map secret events to the resources using them
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &authv1alpha1.OAuthTokenConfig{}, secretIndexKey, secretIndexValues); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &authv1alpha1.OAuthTokenConfig{}, subjectConfigIndexKey, subjectConfigIndexValues); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&authv1alpha1.OAuthTokenConfig{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.requestsForSecret)).
+		Watches(&corev1.Namespace{}, r.namespaceEventHandler()).
+		WithOptions(controller.Options{RateLimiter: newBackoffRateLimiter(r)}).
 		Complete(r)
 }
@@ -2,7 +2,16 @@ package controller
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -12,9 +21,12 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
@@ -135,6 +147,9 @@ var _ = Describe("OAuthTokenConfig Controller", func() {
 			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
 			err := k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)
 			if err == nil {
+				// No controller is running to remove the finalizer
+				oauthTokenConfig.Finalizers = nil
+				Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
 				Expect(k8sClient.Delete(ctx, oauthTokenConfig)).To(Succeed())
 			}
 
@@ -180,6 +195,9 @@ var _ = Describe("OAuthTokenConfig Controller", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_REFRESHED))
 			Expect(oauthTokenConfig.Status.LastRefresh.Time).To(BeTemporally("~", time.Now(), time.Minute))
+			Expect(meta.IsStatusConditionTrue(oauthTokenConfig.Status.Conditions, definitions.CONDITION_READY)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(oauthTokenConfig.Status.Conditions, definitions.CONDITION_CREDENTIALS_VALID)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(oauthTokenConfig.Status.Conditions, definitions.CONDITION_REFRESH_TOKEN_VALID)).To(BeTrue())
 
 			// Check if username and password were part of the data sent to mock server
 			Expect(receivedRequestBodies).To(HaveLen(1))
@@ -353,6 +371,132 @@ var _ = Describe("OAuthTokenConfig Controller", func() {
 			err = k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)
 			Expect(err).To(HaveOccurred(), "Expected an error when target secret is not found")
 			Expect(target.Name).To(BeEmpty(), "Expected target secret to not be created")
+
+			// Verify that the failure is reported in the conditions
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.ConsecutiveFailures).To(Equal(int32(1)))
+			condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_TOKEN_ACQUIRED)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(definitions.REASON_ENDPOINT_UNREACHABLE))
+			Expect(meta.IsStatusConditionFalse(oauthTokenConfig.Status.Conditions, definitions.CONDITION_READY)).To(BeTrue())
+		})
+
+		It("should wait for the Retry-After of a rate limited token request", func() {
+			By("Answering the token request with 429 Too Many Requests")
+			requests := 0
+			mockServer.Close()
+			mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Retry-After", "120")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, err := w.Write([]byte(`{"error": "slow_down"}`))
+				Expect(err).NotTo(HaveOccurred())
+			}))
+			defer mockServer.Close()
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10),
+				HTTPClient:    mockServer.Client(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(HaveOccurred())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.NextRetry.Time).To(BeTemporally(">", time.Now().Add(110*time.Second)))
+			condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_TOKEN_ACQUIRED)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(definitions.REASON_RATE_LIMITED))
+
+			By("Reconciling again before the next retry")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 110*time.Second))
+			Expect(requests).To(Equal(1))
+		})
+
+		It("should throttle token requests exceeding the rate limit of the token endpoint", func() {
+			By("Allowing a single token request per hour")
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				EventRecorder:   record.NewFakeRecorder(10),
+				HTTPClient:      mockServer.Client(),
+				EndpointLimiter: NewEndpointLimiter(1.0/3600, 1, 0, 0),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(oauthTokenConfig.Status.Conditions, definitions.CONDITION_THROTTLED)).To(BeTrue())
+			oauthTokenConfig.Status.NextRefresh = metav1.NewTime(time.Now())
+			Expect(k8sClient.Status().Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			By("Refreshing the token before the next request is allowed")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(receivedRequestBodies).To(HaveLen(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_THROTTLED)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(definitions.REASON_RATE_LIMITED))
+			Expect(meta.IsStatusConditionTrue(oauthTokenConfig.Status.Conditions, definitions.CONDITION_READY)).To(BeTrue())
+		})
+
+		It("should pause token requests to a failing token endpoint", func() {
+			By("Opening the circuit after a failed token request")
+			requests := 0
+			mockServer.Close()
+			mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			defer mockServer.Close()
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				EventRecorder:   record.NewFakeRecorder(10),
+				HTTPClient:      mockServer.Client(),
+				EndpointLimiter: NewEndpointLimiter(0, 1, 1, time.Hour),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(HaveOccurred())
+
+			By("Retrying while the circuit is open")
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Status.NextRetry = metav1.Time{}
+			Expect(k8sClient.Status().Update(ctx, oauthTokenConfig)).To(Succeed())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(requests).To(Equal(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_THROTTLED)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(definitions.REASON_CIRCUIT_OPEN))
+			Expect(oauthTokenConfig.Status.ConsecutiveFailures).To(Equal(int32(1)))
 		})
 
 		It("should emit event if credentials secret not found", func() {
@@ -501,5 +645,1033 @@ var _ = Describe("OAuthTokenConfig Controller", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(target.Name).To(BeEmpty())
 		})
-	})
-})
+
+		It("should successfully reconcile the resource with grant type client_credentials", func() {
+			By("Switching the resource to the client_credentials grant type")
+			// Create a mock HTTP server that returns no refresh token
+			mockServer.Close() // Close the previous mock server
+			mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal("POST"))
+				Expect(r.URL.Path).To(Equal("/oauth/token"))
+
+				bodyBytes, err := io.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+				formData, err := url.ParseQuery(string(bodyBytes))
+				Expect(err).NotTo(HaveOccurred())
+				bodyMap := make(map[string]interface{})
+				for key, values := range formData {
+					if len(values) > 0 {
+						bodyMap[key] = values[0]
+					}
+				}
+				receivedRequestBodies = append(receivedRequestBodies, bodyMap)
+
+				w.WriteHeader(http.StatusOK)
+				_, err = w.Write([]byte(`{"access_token": "mock-access-token", "expires_in": 360}`))
+				Expect(err).NotTo(HaveOccurred())
+			}))
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Type = "client_credentials"
+			oauthTokenConfig.Spec.TokenURL = mockServer.URL + "/oauth/token"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			// Remove username and password, they are not needed for client_credentials
+			credentials := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: credentialsSecret, Namespace: namespace}, credentials)).To(Succeed())
+			delete(credentials.Data, usernameField)
+			delete(credentials.Data, passwordField)
+			Expect(k8sClient.Update(ctx, credentials)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify that only the access token was written to the target secret
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+			Expect(target.Data).NotTo(HaveKey(refreshTokenField))
+
+			// Verify that the status was updated without a refresh expiration time
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_REFRESHED))
+			Expect(oauthTokenConfig.Status.RefreshExpirationTime.IsZero()).To(BeTrue())
+
+			// Check that the client credentials grant was requested
+			Expect(receivedRequestBodies).To(HaveLen(1))
+			Expect(receivedRequestBodies[0][oauthTokenConfig.Spec.TokenRequest.GrantTypeFieldName]).To(Equal("client_credentials"))
+			Expect(receivedRequestBodies[0][oauthTokenConfig.Spec.TokenRequest.ClientIDFieldName]).To(Equal("test-client-id"))
+			Expect(receivedRequestBodies[0]).NotTo(HaveKey(oauthTokenConfig.Spec.TokenRequest.UsernameFieldName))
+		})
+
+		It("should present the client certificate from the TLS secret and pick up rotations", func() {
+			By("Creating a mock HTTP server requiring a client certificate")
+			receivedCommonNames := []string{}
+			mockServer.Close() // Close the previous mock server
+			mockServer = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.TLS.PeerCertificates).NotTo(BeEmpty())
+				receivedCommonNames = append(receivedCommonNames, r.TLS.PeerCertificates[0].Subject.CommonName)
+
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte(`{"access_token": "mock-access-token", "expires_in": 360}`))
+				Expect(err).NotTo(HaveOccurred())
+			}))
+			mockServer.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+			mockServer.StartTLS()
+
+			// Create the TLS secret
+			certificate, key := generateClientCertificate("first-client")
+			tlsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-tls-secret",
+					Namespace: namespace,
+				},
+				Type: corev1.SecretTypeTLS,
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       certificate,
+					corev1.TLSPrivateKeyKey: key,
+				},
+			}
+			Expect(k8sClient.Create(ctx, tlsSecret)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(ctx, tlsSecret)).To(Succeed())
+			}()
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Type = "client_credentials"
+			oauthTokenConfig.Spec.TokenURL = mockServer.URL + "/oauth/token"
+			oauthTokenConfig.Spec.ClientAuthentication = &authv1alpha1.ClientAuthenticationConfig{Method: "tls_client_auth"}
+			oauthTokenConfig.Spec.TLS = &authv1alpha1.TLSConfig{
+				SecretRef: corev1.SecretReference{Name: tlsSecret.Name, Namespace: namespace},
+			}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client trusting the server certificate
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Rotating the client certificate")
+			certificate, key = generateClientCertificate("second-client")
+			tlsSecret.Data[corev1.TLSCertKey] = certificate
+			tlsSecret.Data[corev1.TLSPrivateKeyKey] = key
+			Expect(k8sClient.Update(ctx, tlsSecret)).To(Succeed())
+
+			// Set next refresh time to now
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Status.NextRefresh = metav1.NewTime(time.Now())
+			Expect(k8sClient.Status().Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(receivedCommonNames).To(Equal([]string{"first-client", "second-client"}))
+		})
+
+		It("should exchange the subject token again when it changes", func() {
+			By("Switching the resource to the token-exchange grant type")
+			subjectSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-subject-secret",
+					Namespace: namespace,
+				},
+				Data: map[string][]byte{
+					"token": []byte("first-subject-token"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, subjectSecret)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(ctx, subjectSecret)).To(Succeed())
+			}()
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Type = "token-exchange"
+			oauthTokenConfig.Spec.TokenExchange = &authv1alpha1.TokenExchangeConfig{
+				SubjectToken: authv1alpha1.TokenSource{
+					SecretKeyRef: &authv1alpha1.SecretKeyReference{Name: subjectSecret.Name, Key: "token"},
+				},
+				Audience: []string{"downstream-service"},
+			}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Changing the subject token before the next refresh is due")
+			subjectSecret.Data["token"] = []byte("second-subject-token")
+			Expect(k8sClient.Update(ctx, subjectSecret)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that both subject tokens were exchanged
+			Expect(receivedRequestBodies).To(HaveLen(2))
+			Expect(receivedRequestBodies[0]["grant_type"]).To(Equal("urn:ietf:params:oauth:grant-type:token-exchange"))
+			Expect(receivedRequestBodies[0]["subject_token"]).To(Equal("first-subject-token"))
+			Expect(receivedRequestBodies[0]["audience"]).To(Equal("downstream-service"))
+			Expect(receivedRequestBodies[1]["subject_token"]).To(Equal("second-subject-token"))
+		})
+
+		It("should surface the user code of a device authorization and poll until it is completed", func() {
+			By("Starting a mock authorization server with a device authorization endpoint")
+			polls := 0
+			deviceServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.ParseForm()).To(Succeed())
+				switch r.URL.Path {
+				case "/oauth/device":
+					Expect(r.PostForm.Get("scope")).To(Equal("offline_access"))
+					_, err := w.Write([]byte(`{
+						"device_code": "mock-device-code",
+						"user_code": "ABCD-EFGH",
+						"verification_uri": "https://example.com/device",
+						"verification_uri_complete": "https://example.com/device?user_code=ABCD-EFGH",
+						"expires_in": 600,
+						"interval": 1
+					}`))
+					Expect(err).NotTo(HaveOccurred())
+				case "/oauth/token":
+					polls++
+					Expect(r.PostForm.Get("grant_type")).To(Equal("urn:ietf:params:oauth:grant-type:device_code"))
+					Expect(r.PostForm.Get("device_code")).To(Equal("mock-device-code"))
+					if polls == 1 {
+						w.WriteHeader(http.StatusBadRequest)
+						_, err := w.Write([]byte(`{"error": "authorization_pending"}`))
+						Expect(err).NotTo(HaveOccurred())
+						return
+					}
+					_, err := w.Write([]byte(`{"access_token": "mock-access-token", "refresh_token": "mock-refresh-token", "expires_in": 360}`))
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}))
+			defer deviceServer.Close()
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Type = "device_code"
+			oauthTokenConfig.Spec.TokenURL = deviceServer.URL + "/oauth/token"
+			oauthTokenConfig.Spec.DeviceCode = &authv1alpha1.DeviceCodeConfig{
+				DeviceAuthorizationURL: deviceServer.URL + "/oauth/device",
+				Scope:                  "offline_access",
+			}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			eventRecorder := record.NewFakeRecorder(10)
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: eventRecorder,
+				HTTPClient:    deviceServer.Client(),
+			}
+			now := time.Now()
+			controllerReconciler.grants.Now = func() time.Time { return now }
+
+			By("Starting the device authorization")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Second))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_PENDING))
+			Expect(oauthTokenConfig.Status.DeviceAuthorization).NotTo(BeNil())
+			Expect(oauthTokenConfig.Status.DeviceAuthorization.UserCode).To(Equal("ABCD-EFGH"))
+			Expect(oauthTokenConfig.Status.DeviceAuthorization.VerificationURIComplete).To(Equal("https://example.com/device?user_code=ABCD-EFGH"))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring("ReconciliationStarted")))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring("ABCD-EFGH")))
+			_, pending := controllerReconciler.grants.Load(typeNamespacedName)
+			Expect(pending).To(BeTrue())
+
+			By("Polling while the authorization is pending")
+			now = now.Add(result.RequeueAfter)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(polls).To(Equal(1))
+
+			By("Polling after the user completed the authorization")
+			now = now.Add(result.RequeueAfter)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(polls).To(Equal(2))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_REFRESHED))
+			Expect(oauthTokenConfig.Status.DeviceAuthorization).To(BeNil())
+
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(string(target.Data[refreshTokenField])).To(Equal("mock-refresh-token"))
+
+			By("Dropping the grant state when the resource is deleted")
+			Expect(k8sClient.Delete(ctx, oauthTokenConfig)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, pending = controllerReconciler.grants.Load(typeNamespacedName)
+			Expect(pending).To(BeFalse())
+		})
+
+		It("should seed the refresh_token grant from the credentials secret without a password", func() {
+			By("Replacing username and password with a refresh token")
+			credentials := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: credentialsSecret, Namespace: namespace}, credentials)).To(Succeed())
+			credentials.Data = map[string][]byte{
+				clientIDField:     []byte("test-client-id"),
+				clientSecretField: []byte("test-client-secret"),
+				refreshTokenField: []byte("seed-refresh-token"),
+			}
+			Expect(k8sClient.Update(ctx, credentials)).To(Succeed())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Type = "refresh_token"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the seed was used and the rotated refresh token was written to the target secret
+			Expect(receivedRequestBodies).To(HaveLen(1))
+			Expect(receivedRequestBodies[0]["grant_type"]).To(Equal("refresh_token"))
+			Expect(receivedRequestBodies[0]["refresh_token"]).To(Equal("seed-refresh-token"))
+			Expect(receivedRequestBodies[0]).NotTo(HaveKey("password"))
+
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(string(target.Data[refreshTokenField])).To(Equal("mock-refresh-token"))
+		})
+
+		It("should require reauthentication if the refresh token is rejected", func() {
+			By("Simulating a rejected refresh token")
+			mockServer.Close() // Close the previous mock server
+			mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, err := w.Write([]byte(`{"error": "invalid_grant"}`))
+				Expect(err).NotTo(HaveOccurred())
+			}))
+
+			credentials := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: credentialsSecret, Namespace: namespace}, credentials)).To(Succeed())
+			credentials.Data[refreshTokenField] = []byte("revoked-refresh-token")
+			Expect(k8sClient.Update(ctx, credentials)).To(Succeed())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Type = "refresh_token"
+			oauthTokenConfig.Spec.TokenURL = mockServer.URL + "/oauth/token"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			eventRecorder := record.NewFakeRecorder(10)
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: eventRecorder,
+				HTTPClient:    mockServer.Client(),
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(REQUEUE_TIME))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_REAUTHENTICATION_REQUIRED))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring("ReconciliationStarted")))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring("ReauthenticationRequired")))
+		})
+
+		It("should render templated keys into a target secret of the configured type", func() {
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Target.Type = corev1.SecretTypeDockerConfigJson
+			oauthTokenConfig.Spec.Target.OmitAccessToken = true
+			oauthTokenConfig.Spec.Target.Templates = map[string]string{
+				corev1.DockerConfigJsonKey: `{"auths": {"registry.example.com": {"auth": "{{ printf "%s:%s" .Credentials.username .AccessToken | b64enc }}"}}}`,
+				"authorization":            "Bearer {{ .AccessToken }}",
+			}
+			oauthTokenConfig.Spec.Target.TemplateCredentialKeys = []string{"username"}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the templates were rendered and the bare access token was omitted
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Type).To(Equal(corev1.SecretTypeDockerConfigJson))
+			Expect(target.Data).To(HaveKeyWithValue("authorization", []byte("Bearer mock-access-token")))
+			Expect(string(target.Data[corev1.DockerConfigJsonKey])).To(ContainSubstring(base64.StdEncoding.EncodeToString([]byte("test-username:mock-access-token"))))
+			Expect(target.Data).NotTo(HaveKey(accessTokenField))
+			Expect(target.Data).To(HaveKeyWithValue(refreshTokenField, []byte("mock-refresh-token")))
+		})
+
+		It("should write the token to additional targets in selected namespaces", func() {
+			// Namespaces cannot be removed in envtest, generated names keep the test repeatable
+			selected := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "selected-", Labels: map[string]string{"otto-test": "selected"}}}
+			Expect(k8sClient.Create(ctx, selected)).To(Succeed())
+			other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "other-"}}
+			Expect(k8sClient.Create(ctx, other)).To(Succeed())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Target.ConfigMap = &authv1alpha1.ConfigMapTargetConfig{Name: "token-metadata"}
+			oauthTokenConfig.Spec.AdditionalTargets = []authv1alpha1.TargetConfig{{
+				SecretRef:             corev1.SecretReference{Name: "copied-token"},
+				AccessTokenFieldName:  accessTokenField,
+				RefreshTokenFieldName: refreshTokenField,
+				NamespaceSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"otto-test": "selected"}},
+			}}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the selected namespace got the access token but not the refresh token
+			copied := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "copied-token", Namespace: selected.Name}, copied)).To(Succeed())
+			Expect(copied.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+			Expect(copied.Data).NotTo(HaveKey(refreshTokenField))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Name: "copied-token", Namespace: other.Name}, &corev1.Secret{}))).To(BeTrue())
+
+			// Check that the metadata ConfigMap was written next to the primary target
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "token-metadata", Namespace: namespace}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKey("expirationTime"))
+			Expect(configMap.Data["lastRefresh"]).NotTo(BeEmpty())
+			Expect(k8sClient.Delete(ctx, configMap)).To(Succeed())
+		})
+
+		It("should remove the copy from a namespace which is no longer selected", func() {
+			// Namespaces cannot be removed in envtest, generated names keep the test repeatable
+			selected := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "unselected-", Labels: map[string]string{"otto-test": "unselected"}}}
+			Expect(k8sClient.Create(ctx, selected)).To(Succeed())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.AdditionalTargets = []authv1alpha1.TargetConfig{{
+				SecretRef:             corev1.SecretReference{Name: "copied-token"},
+				AccessTokenFieldName:  accessTokenField,
+				RefreshTokenFieldName: refreshTokenField,
+				NamespaceSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"otto-test": "unselected"}},
+			}}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			copiedName := types.NamespacedName{Name: "copied-token", Namespace: selected.Name}
+			Expect(k8sClient.Get(ctx, copiedName, &corev1.Secret{})).To(Succeed())
+
+			// Remove the label, the spec stays unchanged
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: selected.Name}, selected)).To(Succeed())
+			selected.Labels = nil
+			Expect(k8sClient.Update(ctx, selected)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the copy created by the controller was deleted with the default policy
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, copiedName, &corev1.Secret{}))).To(BeTrue())
+		})
+
+		It("should label the target secret and only remove its keys on deletion with RemoveKeysOnly", func() {
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.DeletionPolicy = definitions.DELETION_POLICY_REMOVE_KEYS_ONLY
+			oauthTokenConfig.Spec.Target.Labels = map[string]string{"team": "platform"}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check the finalizer and the labels and annotation of the target secret
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Finalizers).To(ContainElement(definitions.FINALIZER))
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Labels).To(HaveKeyWithValue(definitions.LABEL_MANAGED_BY, definitions.MANAGED_BY))
+			Expect(target.Labels).To(HaveKeyWithValue("team", "platform"))
+			Expect(target.Annotations).To(HaveKeyWithValue(definitions.ANNOTATION_OWNER, namespace+"/"+resourceName))
+			Expect(target.OwnerReferences).To(BeEmpty())
+
+			// Keys not written by the controller survive the deletion
+			target.Data["unrelated"] = []byte("keep")
+			Expect(k8sClient.Update(ctx, target)).To(Succeed())
+
+			Expect(k8sClient.Delete(ctx, oauthTokenConfig)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &authv1alpha1.OAuthTokenConfig{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(Equal(map[string][]byte{"unrelated": []byte("keep")}))
+			Expect(target.Labels).NotTo(HaveKey(definitions.LABEL_MANAGED_BY))
+
+			By("Reconciling the removed resource")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should only remove its keys from an existing target secret on deletion with the default policy", func() {
+			// The target secret exists before the resource and holds keys of another application
+			existing := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: targetSecret, Namespace: namespace},
+				Data:       map[string][]byte{"foreign": []byte("keep")},
+			}
+			Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the existing secret is not marked as created and gets no owner reference
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKey(accessTokenField))
+			Expect(target.Annotations).NotTo(HaveKey(definitions.ANNOTATION_CREATED_BY))
+			Expect(target.OwnerReferences).To(BeEmpty())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, oauthTokenConfig)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the secret and the keys of the other application survive the deletion
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &authv1alpha1.OAuthTokenConfig{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(Equal(map[string][]byte{"foreign": []byte("keep")}))
+			Expect(target.Annotations).NotTo(HaveKey(definitions.ANNOTATION_OWNER))
+
+			// The credentials secret is never deleted
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: credentialsSecret, Namespace: namespace}, &corev1.Secret{})).To(Succeed())
+		})
+
+		It("should revoke the refresh and access token when the resource is deleted", func() {
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			// The mock server answers every request on the token path with 200
+			oauthTokenConfig.Spec.RevocationURL = mockServer.URL + "/oauth/token"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receivedRequestBodies).To(HaveLen(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, oauthTokenConfig)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the refresh token was revoked before the access token
+			Expect(receivedRequestBodies).To(HaveLen(3))
+			Expect(receivedRequestBodies[1]).To(HaveKeyWithValue("token", "mock-refresh-token"))
+			Expect(receivedRequestBodies[1]).To(HaveKeyWithValue("token_type_hint", "refresh_token"))
+			Expect(receivedRequestBodies[2]).To(HaveKeyWithValue("token", "mock-access-token"))
+			Expect(receivedRequestBodies[2]).To(HaveKeyWithValue("token_type_hint", "access_token"))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &authv1alpha1.OAuthTokenConfig{}))).To(BeTrue())
+		})
+
+		It("should wait between failed revocation attempts", func() {
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			// Nothing listens on the revocation endpoint
+			oauthTokenConfig.Spec.RevocationURL = "http://127.0.0.1:1/revoke"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, oauthTokenConfig)).To(Succeed())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(REQUEUE_TIME))
+
+			// Check that the event of the status update does not retry the revocation before the next attempt
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.RevocationAttempts).To(Equal(int32(1)))
+			Expect(oauthTokenConfig.Status.NextRetry.IsZero()).To(BeFalse())
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.RevocationAttempts).To(Equal(int32(1)))
+
+			// The skip-revocation annotation deletes the resource right away
+			oauthTokenConfig.Annotations = map[string]string{definitions.ANNOTATION_SKIP_REVOCATION: "true"}
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &authv1alpha1.OAuthTokenConfig{}))).To(BeTrue())
+		})
+
+		It("should share the target secret with other writers key by key", func() {
+			// Another writer applies its own key to the target secret
+			other := &corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: metav1.ObjectMeta{Name: targetSecret, Namespace: namespace},
+				Data:       map[string][]byte{"other-key": []byte("other-value")},
+			}
+			Expect(k8sClient.Patch(ctx, other, client.Apply, client.FieldOwner("other-writer"))).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that both writers' keys are present and the condition is set
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKeyWithValue("other-key", []byte("other-value")))
+			Expect(target.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_TARGET_WRITTEN)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should surface a conflict with another writer applying the same key", func() {
+			other := &corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: metav1.ObjectMeta{Name: targetSecret, Namespace: namespace},
+				Data:       map[string][]byte{accessTokenField: []byte("other-token")},
+			}
+			Expect(k8sClient.Patch(ctx, other, client.Apply, client.FieldOwner("other-writer"))).To(Succeed())
+
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(10), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(HaveOccurred())
+
+			// Check that the key of the other writer was kept and the conflict is reported
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKeyWithValue(accessTokenField, []byte("other-token")))
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_FAILED))
+			condition := meta.FindStatusCondition(oauthTokenConfig.Status.Conditions, definitions.CONDITION_TARGET_WRITTEN)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(definitions.REASON_CONFLICT))
+			Expect(condition.Message).To(ContainSubstring("other-writer"))
+
+			By("Retrying after the other writer released the key")
+			other.Data = nil
+			Expect(k8sClient.Patch(ctx, other, client.Apply, client.FieldOwner("other-writer"))).To(Succeed())
+			oauthTokenConfig.Status.NextRetry = metav1.Time{}
+			Expect(k8sClient.Status().Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the tokens of the first request were written without a new token request
+			Expect(receivedRequestBodies).To(HaveLen(1))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+			Expect(target.Data).To(HaveKeyWithValue(refreshTokenField, []byte("mock-refresh-token")))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.Status).To(Equal(definitions.STATUS_REFRESHED))
+		})
+
+		It("should authenticate again when the credentials change", func() {
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Rotate the password before the next refresh is due
+			credentials := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: credentialsSecret, Namespace: namespace}, credentials)).To(Succeed())
+			credentials.Data[passwordField] = []byte("rotated-password")
+			Expect(k8sClient.Update(ctx, credentials)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the new password was used instead of the refresh token
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(receivedRequestBodies).To(HaveLen(2))
+			Expect(receivedRequestBodies[1][oauthTokenConfig.Spec.TokenRequest.PasswordFieldName]).To(Equal("rotated-password"))
+			Expect(receivedRequestBodies[1]).NotTo(HaveKey(oauthTokenConfig.Spec.TokenRequest.RefreshTokenFieldName))
+		})
+
+		It("should restore a deleted target secret from the last token", func() {
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, target)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the secret was written again without a new token request
+			target = &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+			Expect(target.Data).To(HaveKeyWithValue(refreshTokenField, []byte("mock-refresh-token")))
+			Expect(receivedRequestBodies).To(HaveLen(1))
+		})
+
+		It("should request a new token for a deleted target secret after a restart", func() {
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			target := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, target)).To(Succeed())
+
+			// A new reconciler has no cached token, like the controller after a restart
+			restartedReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+			_, err = restartedReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the secret was restored right away instead of at the next refresh
+			target = &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, target)).To(Succeed())
+			Expect(target.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+			Expect(receivedRequestBodies).To(HaveLen(2))
+		})
+
+		It("should move the token to a renamed target secret without a new token request", func() {
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Rename the target secret before the next refresh is due
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.Target.SecretRef.Name = "renamed-target-secret"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the token was moved and the old secret was removed with the Delete policy
+			renamed := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "renamed-target-secret", Namespace: namespace}, renamed)).To(Succeed())
+			Expect(renamed.Data).To(HaveKeyWithValue(accessTokenField, []byte("mock-access-token")))
+			Expect(renamed.Data).To(HaveKeyWithValue(refreshTokenField, []byte("mock-refresh-token")))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, &corev1.Secret{}))).To(BeTrue())
+			Expect(receivedRequestBodies).To(HaveLen(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.ObservedGeneration).To(Equal(oauthTokenConfig.Generation))
+
+			Expect(k8sClient.Delete(ctx, renamed)).To(Succeed())
+		})
+
+		It("should move the token to a renamed target secret after a restart", func() {
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			Expect(oauthTokenConfig.Status.WrittenTarget).NotTo(BeNil())
+			Expect(oauthTokenConfig.Status.WrittenTarget.AccessTokenFieldName).To(Equal(accessTokenField))
+			oauthTokenConfig.Spec.Target.SecretRef.Name = "renamed-target-secret"
+			oauthTokenConfig.Spec.Target.AccessTokenFieldName = "renamed-access-token"
+			oauthTokenConfig.Spec.Target.RefreshTokenFieldName = "renamed-refresh-token"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			// A new reconciler has no cached token, like the controller after a restart
+			restartedReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+			_, err = restartedReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the tokens were read from the old secret with the old field names without a new token request
+			renamed := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "renamed-target-secret", Namespace: namespace}, renamed)).To(Succeed())
+			Expect(renamed.Data).To(HaveKeyWithValue("renamed-access-token", []byte("mock-access-token")))
+			Expect(renamed.Data).To(HaveKeyWithValue("renamed-refresh-token", []byte("mock-refresh-token")))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Name: targetSecret, Namespace: namespace}, &corev1.Secret{}))).To(BeTrue())
+			Expect(receivedRequestBodies).To(HaveLen(1))
+
+			Expect(k8sClient.Delete(ctx, renamed)).To(Succeed())
+		})
+
+		It("should request a new token when the token request changes", func() {
+			controllerReconciler := &OAuthTokenConfigReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				EventRecorder: record.NewFakeRecorder(20), // Initialize the EventRecorder
+				HTTPClient:    mockServer.Client(),        // Use the mock HTTP client
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.TokenRequest.Scope = "offline_access"
+			Expect(k8sClient.Update(ctx, oauthTokenConfig)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Check that the token was requested with the password again instead of waiting for the next refresh
+			Expect(receivedRequestBodies).To(HaveLen(2))
+			Expect(receivedRequestBodies[1][oauthTokenConfig.Spec.TokenRequest.PasswordFieldName]).To(Equal("test-password"))
+		})
+
+		It("should index the secrets a resource reads and writes", func() {
+			oauthTokenConfig := &authv1alpha1.OAuthTokenConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, oauthTokenConfig)).To(Succeed())
+			oauthTokenConfig.Spec.AdditionalTargets = []authv1alpha1.TargetConfig{
+				{SecretRef: corev1.SecretReference{Name: "copy"}},
+				{SecretRef: corev1.SecretReference{Name: "fan-out"}, NamespaceSelector: &metav1.LabelSelector{}},
+			}
+			oauthTokenConfig.Spec.TLS = &authv1alpha1.TLSConfig{SecretRef: corev1.SecretReference{Name: "client-tls", Namespace: namespace}}
+			oauthTokenConfig.Spec.TokenExchange = &authv1alpha1.TokenExchangeConfig{
+				SubjectToken: authv1alpha1.TokenSource{SecretKeyRef: &authv1alpha1.SecretKeyReference{Name: "subject", Key: "token"}},
+			}
+
+			Expect(secretIndexValues(oauthTokenConfig)).To(ConsistOf(
+				namespace+"/"+credentialsSecret,
+				namespace+"/client-tls",
+				namespace+"/subject",
+				namespace+"/"+targetSecret,
+				namespace+"/copy",
+				"*/fan-out",
+			))
+			Expect(subjectConfigIndexValues(oauthTokenConfig)).To(BeEmpty())
+
+			// A resource exchanging the access token of another one is indexed by the referenced resource
+			oauthTokenConfig.Spec.TokenExchange.SubjectToken = authv1alpha1.TokenSource{OAuthTokenConfigRef: &authv1alpha1.OAuthTokenConfigReference{Name: "upstream"}}
+			Expect(subjectConfigIndexValues(oauthTokenConfig)).To(ConsistOf(namespace + "/upstream"))
+		})
+	})
+})
+
+// generateClientCertificate creates a self-signed client certificate and returns the PEM encoded certificate and key
+func generateClientCertificate(commonName string) ([]byte, []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	Expect(err).NotTo(HaveOccurred())
+	key, err := x509.MarshalECPrivateKey(privateKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key})
+}
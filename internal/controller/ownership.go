@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// function to get the value of the owner annotation of an OAuthTokenConfig
+func ownerKey(oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	return oauthTokenConfig.Namespace + "/" + oauthTokenConfig.Name
+}
+
+// function to get the deletion policy of an OAuthTokenConfig, Delete if it is not set
+func deletionPolicy(oauthTokenConfig authv1alpha1.OAuthTokenConfig) string {
+	if oauthTokenConfig.Spec.DeletionPolicy == "" {
+		return definitions.DELETION_POLICY_DELETE
+	}
+	return oauthTokenConfig.Spec.DeletionPolicy
+}
+
+// function to check if an existing secret or ConfigMap is owned by another OAuthTokenConfig writing other keys to it
+func sharedWith(oauthTokenConfig authv1alpha1.OAuthTokenConfig, obj metav1.Object) bool {
+	owner := obj.GetAnnotations()[definitions.ANNOTATION_OWNER]
+	return owner != "" && owner != ownerKey(oauthTokenConfig)
+}
+
+// function to check if a secret or ConfigMap was created by the controller for an OAuthTokenConfig
+func createdBy(oauthTokenConfig authv1alpha1.OAuthTokenConfig, obj metav1.Object) bool {
+	return obj.GetAnnotations()[definitions.ANNOTATION_CREATED_BY] == ownerKey(oauthTokenConfig)
+}
+
+// function to set the labels, annotations and owner reference of a secret or ConfigMap written for a target,
+// the owner annotation and reference are left to the first owner of a shared object. Only an object created by the
+// controller is marked as created and gets the owner reference, an existing object of a user is never deleted
+func applyOwnership(oauthTokenConfig authv1alpha1.OAuthTokenConfig, target authv1alpha1.TargetConfig, obj metav1.Object, shared bool, created bool) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range target.Labels {
+		labels[key] = value
+	}
+	labels[definitions.LABEL_MANAGED_BY] = definitions.MANAGED_BY
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for key, value := range target.Annotations {
+		annotations[key] = value
+	}
+	if !shared {
+		annotations[definitions.ANNOTATION_OWNER] = ownerKey(oauthTokenConfig)
+	}
+	if created {
+		annotations[definitions.ANNOTATION_CREATED_BY] = ownerKey(oauthTokenConfig)
+	}
+	obj.SetAnnotations(annotations)
+
+	// Owner references cannot cross namespaces and would let the garbage collector delete orphaned objects,
+	// they are only set with the Delete policy as a fallback if the finalizer is removed by hand
+	ownerReferences := withoutOwnerReference(obj.GetOwnerReferences(), oauthTokenConfig.UID)
+	if !shared && created && deletionPolicy(oauthTokenConfig) == definitions.DELETION_POLICY_DELETE && obj.GetNamespace() == oauthTokenConfig.Namespace && oauthTokenConfig.UID != "" {
+		ownerReferences = append(ownerReferences, metav1.OwnerReference{
+			APIVersion: authv1alpha1.GroupVersion.String(),
+			Kind:       "OAuthTokenConfig",
+			Name:       oauthTokenConfig.Name,
+			UID:        oauthTokenConfig.UID,
+		})
+	}
+	obj.SetOwnerReferences(ownerReferences)
+}
+
+// function to get the patch releasing an object, it only removes the given keys and the label, annotations and owner
+// reference set by the controller, so changes of other writers since the object was fetched are kept. A shared object
+// keeps the label and annotation of its owner
+func releasePatch(oauthTokenConfig authv1alpha1.OAuthTokenConfig, obj metav1.Object, keys []string) (client.Patch, error) {
+	patch := map[string]any{}
+	metadata := map[string]any{}
+	if len(keys) > 0 {
+		data := map[string]any{}
+		for _, key := range keys {
+			data[key] = nil
+		}
+		patch["data"] = data
+	}
+	if !sharedWith(oauthTokenConfig, obj) {
+		metadata["labels"] = map[string]any{definitions.LABEL_MANAGED_BY: nil}
+		metadata["annotations"] = map[string]any{definitions.ANNOTATION_OWNER: nil, definitions.ANNOTATION_CREATED_BY: nil}
+	}
+	if len(withoutOwnerReference(obj.GetOwnerReferences(), oauthTokenConfig.UID)) != len(obj.GetOwnerReferences()) {
+		metadata["ownerReferences"] = []map[string]any{{"$patch": "delete", "uid": oauthTokenConfig.UID}}
+	}
+	if len(metadata) > 0 {
+		patch["metadata"] = metadata
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	return client.RawPatch(types.StrategicMergePatchType, data), nil
+}
+
+// function to drop the owner references of an owner
+func withoutOwnerReference(ownerReferences []metav1.OwnerReference, uid types.UID) []metav1.OwnerReference {
+	filtered := []metav1.OwnerReference{}
+	for _, ownerReference := range ownerReferences {
+		if ownerReference.UID != uid {
+			filtered = append(filtered, ownerReference)
+		}
+	}
+	return filtered
+}
+
+// function to check if an object was written for an OAuthTokenConfig
+func ownedBy(oauthTokenConfig authv1alpha1.OAuthTokenConfig, obj metav1.Object) bool {
+	return obj.GetLabels()[definitions.LABEL_MANAGED_BY] == definitions.MANAGED_BY && obj.GetAnnotations()[definitions.ANNOTATION_OWNER] == ownerKey(oauthTokenConfig)
+}
+
+// function to collect the keys the controller writes to the target secrets
+func targetKeys(oauthTokenConfig authv1alpha1.OAuthTokenConfig) []string {
+	keys := []string{}
+	targets := append([]authv1alpha1.TargetConfig{oauthTokenConfig.Spec.Target}, oauthTokenConfig.Spec.AdditionalTargets...)
+	for _, target := range targets {
+		keys = append(keys, target.AccessTokenFieldName, target.RefreshTokenFieldName)
+		for _, field := range target.AdditionalFields {
+			keys = append(keys, field.Key)
+		}
+		for key := range target.Templates {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// function to apply the deletion policy to the secrets and ConfigMaps of all targets
+func (r *OAuthTokenConfigReconciler) finalizeTargets(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	log := log.FromContext(ctx)
+	policy := deletionPolicy(oauthTokenConfig)
+	log.V(1).Info("Cleaning up targets", "deletionPolicy", policy)
+
+	// Secrets written before the label was introduced are only found by the name of the primary target, without the
+	// created annotation they only lose the keys of the controller
+	secrets := []corev1.Secret{}
+	primary := &corev1.Secret{}
+	primaryName := types.NamespacedName{Name: oauthTokenConfig.Spec.Target.SecretRef.Name, Namespace: oauthTokenConfig.Spec.Target.SecretRef.Namespace}
+	if err := r.fetchResource(ctx, primaryName, primary); err == nil {
+		secrets = append(secrets, *primary)
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to fetch target secret %s: %w", primaryName, err)
+	}
+
+	managed := client.MatchingLabels{definitions.LABEL_MANAGED_BY: definitions.MANAGED_BY}
+	var secretList corev1.SecretList
+	if err := r.List(ctx, &secretList, managed); err != nil {
+		return fmt.Errorf("failed to list target secrets: %w", err)
+	}
+	for _, secret := range secretList.Items {
+		if ownedBy(oauthTokenConfig, &secret) && (secret.Name != primaryName.Name || secret.Namespace != primaryName.Namespace) {
+			secrets = append(secrets, secret)
+		}
+	}
+	var configMapList corev1.ConfigMapList
+	if err := r.List(ctx, &configMapList, managed); err != nil {
+		return fmt.Errorf("failed to list target ConfigMaps: %w", err)
+	}
+
+	errs := []error{}
+	for i := range secrets {
+		if err := r.releaseSecret(ctx, oauthTokenConfig, &secrets[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range configMapList.Items {
+		if ownedBy(oauthTokenConfig, &configMapList.Items[i]) {
+			if err := r.releaseConfigMap(ctx, oauthTokenConfig, &configMapList.Items[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// function to apply the deletion policy to a target secret. Only a secret created by the controller is deleted, an
+// existing secret, a secret shared with another OAuthTokenConfig and the credentials secret only lose the keys of this one
+func (r *OAuthTokenConfigReconciler) releaseSecret(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, secret *corev1.Secret) error {
+	policy := deletionPolicy(oauthTokenConfig)
+	credentials := oauthTokenConfig.Spec.Credentials.SecretRef
+	isCredentials := credentials.Name == secret.Name && credentials.Namespace == secret.Namespace
+	if policy == definitions.DELETION_POLICY_DELETE && (!createdBy(oauthTokenConfig, secret) || sharedWith(oauthTokenConfig, secret) || isCredentials) {
+		policy = definitions.DELETION_POLICY_REMOVE_KEYS_ONLY
+	}
+	if policy == definitions.DELETION_POLICY_DELETE {
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete target secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		return nil
+	}
+
+	// Only the keys, label, annotations and owner reference of the controller are removed, other writers keep their changes
+	keys := []string{}
+	if policy == definitions.DELETION_POLICY_REMOVE_KEYS_ONLY {
+		keys = targetKeys(oauthTokenConfig)
+	}
+	patch, err := releasePatch(oauthTokenConfig, secret, keys)
+	if err != nil {
+		return fmt.Errorf("failed to release target secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	if err := r.Patch(ctx, secret, patch, client.FieldOwner(fieldManager(oauthTokenConfig))); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to release target secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return nil
+}
+
+// function to apply the deletion policy to a metadata ConfigMap, an existing ConfigMap only loses the keys of the controller
+func (r *OAuthTokenConfigReconciler) releaseConfigMap(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, configMap *corev1.ConfigMap) error {
+	policy := deletionPolicy(oauthTokenConfig)
+	if policy == definitions.DELETION_POLICY_DELETE && !createdBy(oauthTokenConfig, configMap) {
+		policy = definitions.DELETION_POLICY_REMOVE_KEYS_ONLY
+	}
+	if policy == definitions.DELETION_POLICY_DELETE {
+		if err := r.Delete(ctx, configMap); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+		}
+		return nil
+	}
+
+	// Only the keys, label, annotations and owner reference of the controller are removed, other writers keep their changes
+	keys := []string{}
+	if policy == definitions.DELETION_POLICY_REMOVE_KEYS_ONLY {
+		for key := range metadataConfigMapData(oauthTokenConfig) {
+			keys = append(keys, key)
+		}
+	}
+	patch, err := releasePatch(oauthTokenConfig, configMap, keys)
+	if err != nil {
+		return fmt.Errorf("failed to release ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+	if err := r.Patch(ctx, configMap, patch, client.FieldOwner(fieldManager(oauthTokenConfig))); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to release ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+	return nil
+}
+
+// function to collect the secrets and ConfigMaps the current spec of an OAuthTokenConfig writes
+func (r *OAuthTokenConfigReconciler) currentTargets(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (map[types.NamespacedName]bool, map[types.NamespacedName]bool, error) {
+	secrets := map[types.NamespacedName]bool{}
+	configMaps := map[types.NamespacedName]bool{}
+
+	target := oauthTokenConfig.Spec.Target
+	secrets[types.NamespacedName{Name: target.SecretRef.Name, Namespace: target.SecretRef.Namespace}] = true
+	if target.ConfigMap != nil {
+		configMaps[types.NamespacedName{Name: target.ConfigMap.Name, Namespace: target.SecretRef.Namespace}] = true
+	}
+	for _, additionalTarget := range oauthTokenConfig.Spec.AdditionalTargets {
+		namespaces, err := r.targetNamespaces(ctx, oauthTokenConfig, additionalTarget)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, namespace := range namespaces {
+			secrets[types.NamespacedName{Name: additionalTarget.SecretRef.Name, Namespace: namespace}] = true
+			if additionalTarget.ConfigMap != nil {
+				configMaps[types.NamespacedName{Name: additionalTarget.ConfigMap.Name, Namespace: namespace}] = true
+			}
+		}
+	}
+	return secrets, configMaps, nil
+}
+
+// function to apply the deletion policy to the secrets and ConfigMaps written for targets which were removed from
+// the spec, e.g. the old secret of a renamed target
+func (r *OAuthTokenConfigReconciler) pruneTargets(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) error {
+	log := log.FromContext(ctx)
+	secretNames, configMapNames, err := r.currentTargets(ctx, oauthTokenConfig)
+	if err != nil {
+		return err
+	}
+
+	managed := client.MatchingLabels{definitions.LABEL_MANAGED_BY: definitions.MANAGED_BY}
+	var secretList corev1.SecretList
+	if err := r.List(ctx, &secretList, managed); err != nil {
+		return fmt.Errorf("failed to list target secrets: %w", err)
+	}
+	var configMapList corev1.ConfigMapList
+	if err := r.List(ctx, &configMapList, managed); err != nil {
+		return fmt.Errorf("failed to list target ConfigMaps: %w", err)
+	}
+
+	errs := []error{}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if !ownedBy(oauthTokenConfig, secret) || secretNames[types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}] {
+			continue
+		}
+		log.Info("Releasing secret of a removed target", "Secret", secret.Namespace+"/"+secret.Name, "deletionPolicy", deletionPolicy(oauthTokenConfig))
+		if err := r.releaseSecret(ctx, oauthTokenConfig, secret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range configMapList.Items {
+		configMap := &configMapList.Items[i]
+		if !ownedBy(oauthTokenConfig, configMap) || configMapNames[types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}] {
+			continue
+		}
+		log.Info("Releasing ConfigMap of a removed target", "ConfigMap", configMap.Namespace+"/"+configMap.Name, "deletionPolicy", deletionPolicy(oauthTokenConfig))
+		if err := r.releaseConfigMap(ctx, oauthTokenConfig, configMap); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EndpointLimiter coordinates the token requests of all OAuthTokenConfigs per token endpoint host with a shared rate
+// limit and a circuit breaker, which stops the requests to a host for a cooldown after consecutive failures
+type EndpointLimiter struct {
+	qps              rate.Limit
+	burst            int
+	failureThreshold int
+	cooldown         time.Duration
+
+	mutex sync.Mutex
+	hosts map[string]*endpointState
+}
+
+// endpointState holds the rate limit, the reserved requests of throttled resources and the circuit breaker of a host
+type endpointState struct {
+	limiter      *rate.Limiter
+	reservations map[types.NamespacedName]time.Time
+	failures     int
+	openUntil    time.Time
+}
+
+// NewEndpointLimiter creates an EndpointLimiter allowing qps token requests per second and host with bursts of
+// burst requests. A qps of 0 disables the rate limit, a failureThreshold of 0 the circuit breaker
+func NewEndpointLimiter(qps float64, burst int, failureThreshold int, cooldown time.Duration) *EndpointLimiter {
+	limit := rate.Inf
+	if qps > 0 {
+		limit = rate.Limit(qps)
+	}
+	return &EndpointLimiter{
+		qps:              limit,
+		burst:            max(burst, 1),
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		hosts:            map[string]*endpointState{},
+	}
+}
+
+// function to get the state of a host, the caller holds the mutex
+func (l *EndpointLimiter) state(host string) *endpointState {
+	state, ok := l.hosts[host]
+	if !ok {
+		state = &endpointState{
+			limiter:      rate.NewLimiter(l.qps, l.burst),
+			reservations: map[types.NamespacedName]time.Time{},
+		}
+		l.hosts[host] = state
+	}
+	return state
+}
+
+// function to admit a token request of a resource to a host. If the request has to wait, the delay, the reason and
+// message of the Throttled condition are returned. A throttled resource keeps its reserved slot until it is due
+func (l *EndpointLimiter) Admit(host string, name types.NamespacedName, now time.Time) (time.Duration, string, string) {
+	if l == nil {
+		return 0, "", ""
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	state := l.state(host)
+
+	// An open circuit rejects all requests until the cooldown is over, then a single request probes the host
+	if l.failureThreshold > 0 && state.failures >= l.failureThreshold {
+		if now.Before(state.openUntil) {
+			wait := state.openUntil.Sub(now)
+			return wait, definitions.REASON_CIRCUIT_OPEN, fmt.Sprintf("Token requests to %s are paused after %d consecutive failures, next attempt in %s", host, state.failures, wait.Round(time.Second))
+		}
+		state.openUntil = now.Add(l.cooldown)
+	}
+
+	if reserved, ok := state.reservations[name]; ok {
+		if !now.Before(reserved) {
+			delete(state.reservations, name)
+			return 0, "", ""
+		}
+		wait := reserved.Sub(now)
+		return wait, definitions.REASON_RATE_LIMITED, fmt.Sprintf("Token requests to %s are rate limited, next attempt in %s", host, wait.Round(time.Second))
+	}
+
+	wait := state.limiter.ReserveN(now, 1).DelayFrom(now)
+	if wait <= 0 {
+		return 0, "", ""
+	}
+	for reservedName, reserved := range state.reservations {
+		if reserved.Before(now.Add(-time.Minute)) {
+			delete(state.reservations, reservedName)
+		}
+	}
+	state.reservations[name] = now.Add(wait)
+	return wait, definitions.REASON_RATE_LIMITED, fmt.Sprintf("Token requests to %s are rate limited, next attempt in %s", host, wait.Round(time.Second))
+}
+
+// function to get the Admit function of the grant requests of a resource, a request which has to wait for the rate
+// limit or an open circuit of its host is held back with a ThrottledError
+func (r *OAuthTokenConfigReconciler) admitRequests(name types.NamespacedName) func(endpointURL string) error {
+	return func(endpointURL string) error {
+		if wait, reason, message := r.EndpointLimiter.Admit(endpointHost(endpointURL), name, time.Now()); wait > 0 {
+			return &authtypes.ThrottledError{Reason: reason, Message: message, RetryAfter: wait}
+		}
+		return nil
+	}
+}
+
+// function to record the result of a token request to a host, returns true if the circuit opened. Unreachable hosts and
+// rate limit responses count as failures, any other answer of the server closes the circuit
+func (l *EndpointLimiter) Record(host string, err error, now time.Time) bool {
+	if l == nil || l.failureThreshold <= 0 {
+		return false
+	}
+	failed, responded := endpointResult(err)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	state := l.state(host)
+	switch {
+	case failed:
+		state.failures++
+		if state.failures >= l.failureThreshold {
+			state.openUntil = now.Add(l.cooldown)
+		}
+		return state.failures == l.failureThreshold
+	case responded:
+		state.failures = 0
+		state.openUntil = time.Time{}
+	}
+	return false
+}
+
+// function to classify the result of a token request, whether the host failed or responded to it. Errors before the
+// request, e.g. a missing subject token secret, are neither
+func endpointResult(err error) (bool, bool) {
+	if err == nil {
+		return false, true
+	}
+	switch requestFailureReason(err, "") {
+	case definitions.REASON_ENDPOINT_UNREACHABLE, definitions.REASON_RATE_LIMITED:
+		return true, false
+	}
+	var errorResponse *authtypes.ErrorResponse
+	var parseErr *authtypes.ResponseParseError
+	var pendingErr *authtypes.AuthorizationPendingError
+	var reauthenticationErr *authtypes.ReauthenticationRequiredError
+	responded := errors.As(err, &errorResponse) || errors.As(err, &parseErr) || errors.As(err, &pendingErr) || errors.As(err, &reauthenticationErr)
+	return false, responded
+}
+
+// function to get the host of an endpoint the limits apply to
+func endpointHost(endpoint string) string {
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return endpoint
+}
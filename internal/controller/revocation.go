@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	authtypes "github.com/winklermichael/otto/internal/controller/auth_types"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// function to revoke the refresh and access token of a deleted OAuthTokenConfig, returns false if nothing was revoked
+func (r *OAuthTokenConfigReconciler) revokeTokens(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if oauthTokenConfig.Annotations[definitions.ANNOTATION_SKIP_REVOCATION] == "true" {
+		log.Info("Skipping revocation", "annotation", definitions.ANNOTATION_SKIP_REVOCATION)
+		return false, nil
+	}
+	// Orphaned targets keep being used, revoking their tokens would break them
+	if deletionPolicy(oauthTokenConfig) == definitions.DELETION_POLICY_ORPHAN {
+		log.V(1).Info("Skipping revocation of orphaned tokens")
+		return false, nil
+	}
+
+	endpoints, err := r.resolveEndpoints(ctx, oauthTokenConfig)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve endpoints: %w", err)
+	}
+	if endpoints.Revocation == "" {
+		log.V(1).Info("No revocation endpoint configured")
+		return false, nil
+	}
+
+	// The tokens are read from the target secret, the cache covers an omitted access token
+	target := oauthTokenConfig.Spec.Target
+	targetSecret := &corev1.Secret{}
+	targetSecretName := types.NamespacedName{Name: target.SecretRef.Name, Namespace: target.SecretRef.Namespace}
+	if err := r.fetchResource(ctx, targetSecretName, targetSecret); client.IgnoreNotFound(err) != nil {
+		return false, fmt.Errorf("failed to fetch target secret %s: %w", targetSecretName, err)
+	}
+	refreshToken := string(targetSecret.Data[target.RefreshTokenFieldName])
+	accessToken := ""
+	if !target.OmitAccessToken {
+		accessToken = string(targetSecret.Data[target.AccessTokenFieldName])
+	}
+	if cached := r.cachedTokens(types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}); cached != nil {
+		if refreshToken == "" {
+			refreshToken = cached.RefreshToken
+		}
+		if accessToken == "" {
+			accessToken = cached.AccessToken
+		}
+	}
+	if refreshToken == "" && accessToken == "" {
+		log.V(1).Info("No tokens to revoke")
+		return false, nil
+	}
+
+	credentialsSecret := &corev1.Secret{}
+	credentialsSecretName := types.NamespacedName{
+		Name:      oauthTokenConfig.Spec.Credentials.SecretRef.Name,
+		Namespace: oauthTokenConfig.Spec.Credentials.SecretRef.Namespace,
+	}
+	if credentialsSecretName.Name != "" {
+		if err := r.fetchResource(ctx, credentialsSecretName, credentialsSecret); err != nil {
+			return false, fmt.Errorf("failed to fetch credentials secret %s: %w", credentialsSecretName, err)
+		}
+	}
+	httpClient, err := r.httpClientFor(ctx, oauthTokenConfig)
+	if err != nil {
+		return false, err
+	}
+	grantRequest := authtypes.GrantRequest{
+		HTTPClient:        httpClient,
+		KubeClient:        r.Client,
+		OAuthTokenConfig:  oauthTokenConfig,
+		TargetSecret:      *targetSecret,
+		CredentialsSecret: *credentialsSecret,
+		Status:            &oauthTokenConfig.Status,
+		Endpoints:         endpoints,
+	}
+
+	// The refresh token goes first, servers may revoke the access tokens issued with it as well (RFC 7009 section 2.1)
+	errs := []error{}
+	if refreshToken != "" {
+		if err := authtypes.RevokeToken(ctx, grantRequest, refreshToken, authtypes.TokenTypeHintRefreshToken); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revoke refresh token: %w", err))
+		}
+	}
+	if accessToken != "" {
+		if err := authtypes.RevokeToken(ctx, grantRequest, accessToken, authtypes.TokenTypeHintAccessToken); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revoke access token: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+	log.Info("Tokens revoked", "revocationURL", endpoints.Revocation)
+	return true, nil
+}
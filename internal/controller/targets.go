@@ -0,0 +1,402 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tokenCache holds the last tokens of each OAuthTokenConfig, used to populate targets without a new token request.
+// Tokens which were issued but not written to the primary target and the status yet are tracked with their issue time
+type tokenCache struct {
+	mutex     sync.Mutex
+	entries   map[types.NamespacedName]*definitions.Tokens
+	unwritten map[types.NamespacedName]time.Time
+}
+
+// function to remember the last tokens of an OAuthTokenConfig once they were written
+func (r *OAuthTokenConfigReconciler) cacheTokens(name types.NamespacedName, tokens *definitions.Tokens) {
+	r.tokens.mutex.Lock()
+	defer r.tokens.mutex.Unlock()
+	if r.tokens.entries == nil {
+		r.tokens.entries = map[types.NamespacedName]*definitions.Tokens{}
+	}
+	r.tokens.entries[name] = tokens
+	delete(r.tokens.unwritten, name)
+}
+
+// function to remember the tokens of a token request before they are written, a failed write is retried from the cache
+// instead of a new token request, which would send a refresh token the server already replaced
+func (r *OAuthTokenConfigReconciler) cacheIssuedTokens(name types.NamespacedName, tokens *definitions.Tokens, issuedAt time.Time) {
+	r.tokens.mutex.Lock()
+	defer r.tokens.mutex.Unlock()
+	if r.tokens.entries == nil {
+		r.tokens.entries = map[types.NamespacedName]*definitions.Tokens{}
+	}
+	if r.tokens.unwritten == nil {
+		r.tokens.unwritten = map[types.NamespacedName]time.Time{}
+	}
+	r.tokens.entries[name] = tokens
+	r.tokens.unwritten[name] = issuedAt
+}
+
+// function to get the issued tokens of an OAuthTokenConfig which were not written yet and their issue time, nil if
+// there are none or they expired
+func (r *OAuthTokenConfigReconciler) unwrittenTokens(name types.NamespacedName) (*definitions.Tokens, time.Time) {
+	r.tokens.mutex.Lock()
+	defer r.tokens.mutex.Unlock()
+	issuedAt, ok := r.tokens.unwritten[name]
+	tokens := r.tokens.entries[name]
+	if !ok || tokens == nil || (!tokens.ExpiresAt.IsZero() && !time.Now().Before(tokens.ExpiresAt)) {
+		return nil, time.Time{}
+	}
+	return tokens, issuedAt
+}
+
+// function to get the last tokens of an OAuthTokenConfig, nil after a restart of the controller
+func (r *OAuthTokenConfigReconciler) cachedTokens(name types.NamespacedName) *definitions.Tokens {
+	r.tokens.mutex.Lock()
+	defer r.tokens.mutex.Unlock()
+	return r.tokens.entries[name]
+}
+
+// function to drop the tokens of a deleted OAuthTokenConfig
+func (r *OAuthTokenConfigReconciler) forgetTokens(name types.NamespacedName) {
+	r.tokens.mutex.Lock()
+	defer r.tokens.mutex.Unlock()
+	delete(r.tokens.entries, name)
+	delete(r.tokens.unwritten, name)
+}
+
+// function to write the tokens into the data of a target secret, the refresh token is only written to the primary target
+func applyTokens(secret *corev1.Secret, target authv1alpha1.TargetConfig, tokens *definitions.Tokens, renderedKeys map[string][]byte, primary bool) {
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	if target.OmitAccessToken {
+		delete(secret.Data, target.AccessTokenFieldName)
+	} else {
+		secret.Data[target.AccessTokenFieldName] = []byte(tokens.AccessToken)
+	}
+	if primary && tokens.RefreshToken != "" {
+		secret.Data[target.RefreshTokenFieldName] = []byte(tokens.RefreshToken)
+	} else {
+		// Grants like client_credentials return no refresh token, drop a stale one from a previous grant type
+		delete(secret.Data, target.RefreshTokenFieldName)
+	}
+	for _, field := range target.AdditionalFields {
+		if value, ok := tokens.AdditionalFields[field.Key]; ok {
+			secret.Data[field.Key] = []byte(value)
+		} else {
+			delete(secret.Data, field.Key)
+		}
+	}
+
+	// Templates are applied last, a template may replace the access token or an additional field
+	for key, value := range renderedKeys {
+		secret.Data[key] = value
+	}
+}
+
+// function to check if any target needs to be written independently of a token request
+func hasTargetCopies(oauthTokenConfig authv1alpha1.OAuthTokenConfig) bool {
+	return len(oauthTokenConfig.Spec.AdditionalTargets) > 0 || oauthTokenConfig.Spec.Target.ConfigMap != nil
+}
+
+// function to resolve the namespaces of an additional target
+func (r *OAuthTokenConfigReconciler) targetNamespaces(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, target authv1alpha1.TargetConfig) ([]string, error) {
+	if target.NamespaceSelector == nil {
+		if target.SecretRef.Namespace != "" {
+			return []string{target.SecretRef.Namespace}, nil
+		}
+		return []string{oauthTokenConfig.Namespace}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(target.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespaceSelector: %w", err)
+	}
+	var namespaces corev1.NamespaceList
+	if err := r.List(ctx, &namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	names := []string{}
+	for _, namespace := range namespaces.Items {
+		// Terminating namespaces reject new objects
+		if namespace.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		names = append(names, namespace.Name)
+	}
+	return names, nil
+}
+
+// function to write the additional target secrets and the metadata ConfigMaps of all targets, failures of single
+// namespaces do not stop the others
+func (r *OAuthTokenConfigReconciler) syncTargetCopies(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, tokens *definitions.Tokens, credentialsSecret corev1.Secret) error {
+	errs := []error{}
+
+	if oauthTokenConfig.Spec.Target.ConfigMap != nil {
+		namespace := oauthTokenConfig.Spec.Target.SecretRef.Namespace
+		if err := r.writeMetadataConfigMap(ctx, oauthTokenConfig, oauthTokenConfig.Spec.Target, namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Additional targets never see the refresh token, not even in templates
+	copiedTokens := *tokens
+	copiedTokens.RefreshToken = ""
+
+	for i, target := range oauthTokenConfig.Spec.AdditionalTargets {
+		renderedKeys, err := renderTargetTemplates(target, &copiedTokens, credentialsSecret)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("additionalTargets[%d]: %w", i, err))
+			continue
+		}
+		namespaces, err := r.targetNamespaces(ctx, oauthTokenConfig, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("additionalTargets[%d]: %w", i, err))
+			continue
+		}
+		for _, namespace := range namespaces {
+			secretName := types.NamespacedName{Name: target.SecretRef.Name, Namespace: namespace}
+			if err := r.writeTargetSecret(ctx, oauthTokenConfig, secretName, target, &copiedTokens, renderedKeys, false); err != nil {
+				errs = append(errs, err)
+			}
+			if target.ConfigMap != nil {
+				if err := r.writeMetadataConfigMap(ctx, oauthTokenConfig, target, namespace); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// function to write a target secret with server-side apply, it is only written if its content changed
+func (r *OAuthTokenConfigReconciler) writeTargetSecret(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, secretName types.NamespacedName, target authv1alpha1.TargetConfig, tokens *definitions.Tokens, renderedKeys map[string][]byte, primary bool) error {
+	existing := &corev1.Secret{}
+	if err := r.fetchResource(ctx, secretName, existing); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to fetch target secret %s: %w", secretName, err)
+	}
+	exists := existing.ResourceVersion != ""
+	if exists && target.Type != "" && existing.Type != target.Type {
+		return fmt.Errorf("target secret %s has type %s instead of %s, delete it to let it be recreated", secretName, existing.Type, target.Type)
+	}
+	shared := exists && sharedWith(oauthTokenConfig, existing)
+	created := !exists || createdBy(oauthTokenConfig, existing)
+
+	if exists {
+		desired := existing.DeepCopy()
+		applyTokens(desired, target, tokens, renderedKeys, primary)
+		applyOwnership(oauthTokenConfig, target, desired, shared, created)
+		if secretDataEqual(existing.Data, desired.Data) && metadataEqual(existing, desired) {
+			return nil
+		}
+	}
+
+	// The applied secret only holds the fields of this resource, keys of other writers are kept
+	secret := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: secretName.Name, Namespace: secretName.Namespace},
+		Type:       target.Type,
+	}
+	applyTokens(secret, target, tokens, renderedKeys, primary)
+	applyOwnership(oauthTokenConfig, target, secret, shared, created)
+	if err := r.applyResource(ctx, oauthTokenConfig, secret); err != nil {
+		return fmt.Errorf("failed to write target secret %s: %w", secretName, err)
+	}
+	return nil
+}
+
+// function to get the non-sensitive metadata of the token
+func metadataConfigMapData(oauthTokenConfig authv1alpha1.OAuthTokenConfig) map[string]string {
+	return map[string]string{
+		"expirationTime":        formatTime(oauthTokenConfig.Status.ExpirationTime),
+		"refreshExpirationTime": formatTime(oauthTokenConfig.Status.RefreshExpirationTime),
+		"lastRefresh":           formatTime(oauthTokenConfig.Status.LastRefresh),
+		"scope":                 oauthTokenConfig.Status.GrantedScope,
+	}
+}
+
+// function to write the ConfigMap of a target with the non-sensitive metadata of the token using server-side apply
+func (r *OAuthTokenConfigReconciler) writeMetadataConfigMap(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig, target authv1alpha1.TargetConfig, namespace string) error {
+	data := metadataConfigMapData(oauthTokenConfig)
+	configMapName := types.NamespacedName{Name: target.ConfigMap.Name, Namespace: namespace}
+
+	existing := &corev1.ConfigMap{}
+	if err := r.fetchResource(ctx, configMapName, existing); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to fetch ConfigMap %s: %w", configMapName, err)
+	}
+	exists := existing.ResourceVersion != ""
+	shared := exists && sharedWith(oauthTokenConfig, existing)
+	created := !exists || createdBy(oauthTokenConfig, existing)
+
+	if exists {
+		desired := existing.DeepCopy()
+		applyOwnership(oauthTokenConfig, target, desired, shared, created)
+		changed := !metadataEqual(existing, desired)
+		for key, value := range data {
+			if current, ok := existing.Data[key]; !ok || current != value {
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: configMapName.Name, Namespace: configMapName.Namespace},
+		Data:       data,
+	}
+	applyOwnership(oauthTokenConfig, target, configMap, shared, created)
+	if err := r.applyResource(ctx, oauthTokenConfig, configMap); err != nil {
+		return fmt.Errorf("failed to write ConfigMap %s: %w", configMapName, err)
+	}
+	return nil
+}
+
+// function to format an optional timestamp for a ConfigMap
+func formatTime(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.UTC().Format(time.RFC3339)
+}
+
+// function to compare the labels, annotations and owner references of two objects
+func metadataEqual(a, b metav1.Object) bool {
+	return equality.Semantic.DeepEqual(a.GetLabels(), b.GetLabels()) &&
+		equality.Semantic.DeepEqual(a.GetAnnotations(), b.GetAnnotations()) &&
+		equality.Semantic.DeepEqual(a.GetOwnerReferences(), b.GetOwnerReferences())
+}
+
+// function to compare the data of two secrets
+func secretDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// function to write all targets from the cached tokens, restoring a deleted or edited target secret without a token
+// request, returns false if there are no cached tokens
+func (r *OAuthTokenConfigReconciler) syncCachedTargets(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (bool, error) {
+	tokens := r.cachedTokens(types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace})
+	if tokens == nil {
+		return false, nil
+	}
+
+	// The credentials are only needed for templates
+	credentialsSecret := &corev1.Secret{}
+	credentialsSecretName := types.NamespacedName{
+		Name:      oauthTokenConfig.Spec.Credentials.SecretRef.Name,
+		Namespace: oauthTokenConfig.Spec.Credentials.SecretRef.Namespace,
+	}
+	if credentialsSecretName.Name != "" {
+		if err := r.fetchResource(ctx, credentialsSecretName, credentialsSecret); err != nil {
+			return true, fmt.Errorf("failed to fetch credentials secret %s: %w", credentialsSecretName, err)
+		}
+	}
+
+	// The primary target is only written if its content differs from the cached tokens
+	target := oauthTokenConfig.Spec.Target
+	renderedKeys, err := renderTargetTemplates(target, tokens, *credentialsSecret)
+	if err != nil {
+		return true, err
+	}
+	targetSecretName := types.NamespacedName{Name: target.SecretRef.Name, Namespace: target.SecretRef.Namespace}
+	if err := r.writeTargetSecret(ctx, oauthTokenConfig, targetSecretName, target, tokens, renderedKeys, true); err != nil {
+		return true, err
+	}
+	if !hasTargetCopies(oauthTokenConfig) {
+		return true, nil
+	}
+	return true, r.syncTargetCopies(ctx, oauthTokenConfig, tokens, *credentialsSecret)
+}
+
+// function to check if the primary target lost the token while none is cached, e.g. a target secret which was deleted
+// or edited while the controller restarted. It can only be restored with a new token request
+func (r *OAuthTokenConfigReconciler) primaryTargetLost(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) bool {
+	if r.cachedTokens(types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}) != nil {
+		return false
+	}
+	target := oauthTokenConfig.Spec.Target
+	targetSecret := &corev1.Secret{}
+	targetSecretName := types.NamespacedName{Name: target.SecretRef.Name, Namespace: target.SecretRef.Namespace}
+	if err := r.fetchResource(ctx, targetSecretName, targetSecret); err != nil {
+		return apierrors.IsNotFound(err)
+	}
+	return !target.OmitAccessToken && len(targetSecret.Data[target.AccessTokenFieldName]) == 0
+}
+
+// function to describe the primary target the token is written to, recorded in the status for recoverRenamedTokens
+func writtenTarget(oauthTokenConfig authv1alpha1.OAuthTokenConfig) *authv1alpha1.WrittenTargetStatus {
+	target := oauthTokenConfig.Spec.Target
+	return &authv1alpha1.WrittenTargetStatus{
+		SecretRef:             target.SecretRef,
+		AccessTokenFieldName:  target.AccessTokenFieldName,
+		RefreshTokenFieldName: target.RefreshTokenFieldName,
+	}
+}
+
+// function to load the tokens of a renamed primary target into the empty cache after a restart of the controller. They
+// are read from the primary target recorded in the status with the field names it was written with, additional targets
+// never hold the refresh token. Returns false if the secret no longer holds the access token
+func (r *OAuthTokenConfigReconciler) recoverRenamedTokens(ctx context.Context, oauthTokenConfig authv1alpha1.OAuthTokenConfig) (bool, error) {
+	name := types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}
+	previous := oauthTokenConfig.Status.WrittenTarget
+	if r.cachedTokens(name) != nil || previous == nil || previous.AccessTokenFieldName == "" {
+		return false, nil
+	}
+	secret := &corev1.Secret{}
+	secretName := types.NamespacedName{Name: previous.SecretRef.Name, Namespace: previous.SecretRef.Namespace}
+	if err := r.fetchResource(ctx, secretName, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to fetch target secret %s: %w", secretName, err)
+	}
+	if !ownedBy(oauthTokenConfig, secret) || len(secret.Data[previous.AccessTokenFieldName]) == 0 {
+		return false, nil
+	}
+
+	// The additional fields are part of the token request hash, they did not change if the tokens are recovered
+	tokens := &definitions.Tokens{
+		AccessToken:      string(secret.Data[previous.AccessTokenFieldName]),
+		ExpiresAt:        oauthTokenConfig.Status.ExpirationTime.Time,
+		RefreshExpiresAt: oauthTokenConfig.Status.RefreshExpirationTime.Time,
+		Scope:            oauthTokenConfig.Status.GrantedScope,
+		AdditionalFields: map[string]string{},
+	}
+	if previous.RefreshTokenFieldName != "" {
+		tokens.RefreshToken = string(secret.Data[previous.RefreshTokenFieldName])
+	}
+	for _, field := range oauthTokenConfig.Spec.Target.AdditionalFields {
+		if value, ok := secret.Data[field.Key]; ok {
+			tokens.AdditionalFields[field.Key] = string(value)
+		}
+	}
+	r.cacheTokens(name, tokens)
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	definitions "github.com/winklermichael/otto/internal/controller/definitions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// templateData is the data the templates of the target secret are rendered with
+type templateData struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	Scope        string
+
+	// Additional fields of the token response by key of the target secret
+	Fields map[string]string
+
+	// Keys of the credentials secret listed in templateCredentialKeys
+	Credentials map[string]string
+}
+
+// sideEffectFuncs are the sprig functions left in the hermetic set which depend on the clock or random numbers, a
+// target rendered with them would change on every write
+var sideEffectFuncs = []string{
+	"ago", "randInt", "shuffle", "bcrypt", "htpasswd", "encryptAES", "genPrivateKey", "genCA", "genCAWithKey",
+	"genSelfSignedCert", "genSelfSignedCertWithKey", "genSignedCert", "genSignedCertWithKey",
+}
+
+// function to get the template functions, the hermetic sprig functions without the ones reading the environment of
+// the controller, resolving host names, reading the clock or generating random values
+func templateFuncs() template.FuncMap {
+	funcs := sprig.HermeticTxtFuncMap()
+	for _, name := range sideEffectFuncs {
+		delete(funcs, name)
+	}
+	return funcs
+}
+
+// function to parse the templates of a target secret
+func parseTargetTemplates(target authv1alpha1.TargetConfig) (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+	for key, text := range target.Templates {
+		tmpl, err := template.New(key).Option("missingkey=error").Funcs(templateFuncs()).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for key %s: %w", key, err)
+		}
+		templates[key] = tmpl
+	}
+	return templates, nil
+}
+
+// function to render the templates of a target secret from the tokens and the credentials keys the target opted in to
+func renderTargetTemplates(target authv1alpha1.TargetConfig, tokens *definitions.Tokens, credentialsSecret corev1.Secret) (map[string][]byte, error) {
+	templates, err := parseTargetTemplates(target)
+	if err != nil {
+		return nil, err
+	}
+
+	data := templateData{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+		Scope:        tokens.Scope,
+		Fields:       map[string]string{},
+		Credentials:  map[string]string{},
+	}
+	for key, value := range tokens.AdditionalFields {
+		data.Fields[key] = value
+	}
+	for _, key := range target.TemplateCredentialKeys {
+		if value, ok := credentialsSecret.Data[key]; ok {
+			data.Credentials[key] = string(value)
+		}
+	}
+
+	// Rendered in a stable order so the first failing key is always the same
+	keys := make([]string, 0, len(templates))
+	for key := range templates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rendered := map[string][]byte{}
+	for _, key := range keys {
+		var buffer bytes.Buffer
+		if err := templates[key].Execute(&buffer, data); err != nil {
+			return nil, fmt.Errorf("failed to render template for key %s: %w", key, err)
+		}
+		rendered[key] = buffer.Bytes()
+	}
+	return rendered, nil
+}
+
+// function to validate the target configuration against the existing target secret
+func validateTarget(oauthTokenConfig authv1alpha1.OAuthTokenConfig, targetSecret corev1.Secret) error {
+	if _, err := parseTargetTemplates(oauthTokenConfig.Spec.Target); err != nil {
+		return err
+	}
+	for i, target := range oauthTokenConfig.Spec.AdditionalTargets {
+		if _, err := parseTargetTemplates(target); err != nil {
+			return fmt.Errorf("additionalTargets[%d]: %w", i, err)
+		}
+		if target.NamespaceSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(target.NamespaceSelector); err != nil {
+				return fmt.Errorf("additionalTargets[%d]: invalid namespaceSelector: %w", i, err)
+			}
+		}
+	}
+
+	// The type of a secret is immutable, an existing secret of another type is not replaced
+	secretType := oauthTokenConfig.Spec.Target.Type
+	if secretType != "" && targetSecret.ResourceVersion != "" && targetSecret.Type != secretType {
+		return fmt.Errorf("target secret %s/%s has type %s instead of %s, delete it to let it be recreated", targetSecret.Namespace, targetSecret.Name, targetSecret.Type, secretType)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+
+	authv1alpha1 "github.com/winklermichael/otto/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// secretIndexKey indexes OAuthTokenConfigs by the secrets they read credentials, client certificates and subject
+// tokens from or write tokens to
+const secretIndexKey = ".spec.secretRefs"
+
+// subjectConfigIndexKey indexes OAuthTokenConfigs by the OAuthTokenConfig whose access token they exchange
+const subjectConfigIndexKey = ".spec.tokenExchange.subjectToken.oauthTokenConfigRef"
+
+// function to get the index values of an OAuthTokenConfig, namespace/name of the credentials, TLS, subject token and
+// target secrets. Additional targets with a namespaceSelector are written to any namespace and indexed as */name
+func secretIndexValues(obj client.Object) []string {
+	oauthTokenConfig, ok := obj.(*authv1alpha1.OAuthTokenConfig)
+	if !ok {
+		return nil
+	}
+	namespaceOrDefault := func(namespace string) string {
+		if namespace == "" {
+			return oauthTokenConfig.Namespace
+		}
+		return namespace
+	}
+
+	values := []string{}
+	if credentials := oauthTokenConfig.Spec.Credentials.SecretRef; credentials.Name != "" {
+		values = append(values, namespaceOrDefault(credentials.Namespace)+"/"+credentials.Name)
+	}
+	if tls := oauthTokenConfig.Spec.TLS; tls != nil {
+		values = append(values, namespaceOrDefault(tls.SecretRef.Namespace)+"/"+tls.SecretRef.Name)
+	}
+	if tokenExchange := oauthTokenConfig.Spec.TokenExchange; tokenExchange != nil && tokenExchange.SubjectToken.SecretKeyRef != nil {
+		subjectSecret := tokenExchange.SubjectToken.SecretKeyRef
+		values = append(values, namespaceOrDefault(subjectSecret.Namespace)+"/"+subjectSecret.Name)
+	}
+	target := oauthTokenConfig.Spec.Target.SecretRef
+	values = append(values, namespaceOrDefault(target.Namespace)+"/"+target.Name)
+	for _, additionalTarget := range oauthTokenConfig.Spec.AdditionalTargets {
+		if additionalTarget.NamespaceSelector != nil {
+			values = append(values, "*/"+additionalTarget.SecretRef.Name)
+		} else {
+			values = append(values, namespaceOrDefault(additionalTarget.SecretRef.Namespace)+"/"+additionalTarget.SecretRef.Name)
+		}
+	}
+	return values
+}
+
+// function to get the index value of an OAuthTokenConfig exchanging the access token of another one, namespace/name
+// of the referenced OAuthTokenConfig
+func subjectConfigIndexValues(obj client.Object) []string {
+	oauthTokenConfig, ok := obj.(*authv1alpha1.OAuthTokenConfig)
+	if !ok || oauthTokenConfig.Spec.TokenExchange == nil || oauthTokenConfig.Spec.TokenExchange.SubjectToken.OAuthTokenConfigRef == nil {
+		return nil
+	}
+	reference := oauthTokenConfig.Spec.TokenExchange.SubjectToken.OAuthTokenConfigRef
+	namespace := reference.Namespace
+	if namespace == "" {
+		namespace = oauthTokenConfig.Namespace
+	}
+	return []string{namespace + "/" + reference.Name}
+}
+
+// function to map a secret to the OAuthTokenConfigs using it as credentials, TLS, target or subject token secret.
+// The target secret of an OAuthTokenConfig also maps to the OAuthTokenConfigs exchanging its access token
+func (r *OAuthTokenConfigReconciler) requestsForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	log := log.FromContext(ctx)
+
+	seen := map[types.NamespacedName]bool{}
+	requests := []reconcile.Request{}
+	enqueue := func(oauthTokenConfigs []authv1alpha1.OAuthTokenConfig) {
+		for _, oauthTokenConfig := range oauthTokenConfigs {
+			name := types.NamespacedName{Name: oauthTokenConfig.Name, Namespace: oauthTokenConfig.Namespace}
+			if !seen[name] {
+				seen[name] = true
+				requests = append(requests, reconcile.Request{NamespacedName: name})
+			}
+		}
+	}
+
+	for _, value := range []string{obj.GetNamespace() + "/" + obj.GetName(), "*/" + obj.GetName()} {
+		var oauthTokenConfigs authv1alpha1.OAuthTokenConfigList
+		if err := r.List(ctx, &oauthTokenConfigs, client.MatchingFields{secretIndexKey: value}); err != nil {
+			log.Error(err, "Failed to list OAuthTokenConfigs", "Secret", value)
+			continue
+		}
+		enqueue(oauthTokenConfigs.Items)
+
+		for _, oauthTokenConfig := range oauthTokenConfigs.Items {
+			if !isPrimaryTarget(oauthTokenConfig, obj) {
+				continue
+			}
+			var subjectConfigs authv1alpha1.OAuthTokenConfigList
+			subjectConfig := oauthTokenConfig.Namespace + "/" + oauthTokenConfig.Name
+			if err := r.List(ctx, &subjectConfigs, client.MatchingFields{subjectConfigIndexKey: subjectConfig}); err != nil {
+				log.Error(err, "Failed to list OAuthTokenConfigs", "OAuthTokenConfig", subjectConfig)
+				continue
+			}
+			enqueue(subjectConfigs.Items)
+		}
+	}
+	return requests
+}
+
+// function to check if a secret is the primary target of an OAuthTokenConfig
+func isPrimaryTarget(oauthTokenConfig authv1alpha1.OAuthTokenConfig, obj client.Object) bool {
+	target := oauthTokenConfig.Spec.Target.SecretRef
+	namespace := target.Namespace
+	if namespace == "" {
+		namespace = oauthTokenConfig.Namespace
+	}
+	return target.Name == obj.GetName() && namespace == obj.GetNamespace()
+}
+
+// function to map a namespace to the OAuthTokenConfigs with additional targets selecting it
+func (r *OAuthTokenConfigReconciler) requestsForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	log := log.FromContext(ctx)
+
+	var oauthTokenConfigs authv1alpha1.OAuthTokenConfigList
+	if err := r.List(ctx, &oauthTokenConfigs); err != nil {
+		log.Error(err, "Failed to list OAuthTokenConfigs", "Namespace", obj.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, oauthTokenConfig := range oauthTokenConfigs.Items {
+		for _, target := range oauthTokenConfig.Spec.AdditionalTargets {
+			if target.NamespaceSelector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(target.NamespaceSelector)
+			if err != nil {
+				continue
+			}
+			if selector.Matches(labels.Set(obj.GetLabels())) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Name:      oauthTokenConfig.Name,
+					Namespace: oauthTokenConfig.Namespace,
+				}})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// function to get the event handler of namespaces. A new namespace is mapped with its labels, an updated one only if
+// its labels changed, with the old and the new labels, so resources whose namespaceSelector no longer matches remove
+// their copy
+func (r *OAuthTokenConfigReconciler) namespaceEventHandler() handler.EventHandler {
+	enqueue := func(queue workqueue.TypedRateLimitingInterface[reconcile.Request], requests []reconcile.Request) {
+		for _, request := range requests {
+			queue.Add(request)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(queue, r.requestsForNamespace(ctx, e.Object))
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if labels.Equals(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+				return
+			}
+			enqueue(queue, r.requestsForNamespace(ctx, e.ObjectOld))
+			enqueue(queue, r.requestsForNamespace(ctx, e.ObjectNew))
+		},
+	}
+}